@@ -0,0 +1,104 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerAdmin mounts the operator endpoints under /admin. They are only
+// registered when ENABLE_ADMIN=true.
+func (a *app) registerAdmin(r gin.IRouter) {
+	g := r.Group("/admin")
+
+	// Starts the same drain as SIGTERM, so CI can exercise shutdown
+	// without sending signals. Responds before the drain begins.
+	g.POST("/shutdown", func(c *gin.Context) {
+		if !a.graceful.Load() {
+			abortWithError(c, http.StatusConflict, codeGracefulDisabled, "graceful shutdown is disabled")
+			return
+		}
+		if !a.requestShutdown() {
+			abortWithError(c, http.StatusConflict, codeShutdownInProgress, "shutdown already in progress")
+			return
+		}
+		requestLog(c).Info("shutdown requested via admin endpoint", "event", "admin_shutdown", "client_ip", c.ClientIP())
+		c.JSON(http.StatusAccepted, gin.H{"status": "shutting_down"})
+	})
+
+	// Flips between draining and exiting on the next shutdown signal, so
+	// both behaviours can be compared under one live load test.
+	g.GET("/graceful", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"graceful": a.graceful.Load()})
+	})
+	g.PUT("/graceful", func(c *gin.Context) {
+		var body struct {
+			Graceful *bool `json:"graceful"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil || body.Graceful == nil {
+			abortWithError(c, http.StatusBadRequest, codeInvalidRequest, `body must be {"graceful": true|false}`)
+			return
+		}
+		a.graceful.Store(*body.Graceful)
+		requestLog(c).Info("graceful mode changed via admin endpoint", "event", "graceful_mode_changed", "graceful", *body.Graceful, "client_ip", c.ClientIP())
+		c.JSON(http.StatusOK, gin.H{"graceful": *body.Graceful})
+	})
+
+	// The last REQUEST_LOG_SIZE finished requests, newest first, to line
+	// a drain failure up with the traffic just before it
+	g.GET("/requests", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"size": a.cfg.RequestLogSize, "requests": a.history.recent()})
+	})
+
+	// Zeroes the app's metrics so each load-test run starts clean
+	g.POST("/metrics/reset", func(c *gin.Context) {
+		a.metrics.reset()
+		requestLog(c).Info("metrics reset via admin endpoint", "event", "metrics_reset", "client_ip", c.ClientIP())
+		c.JSON(http.StatusOK, gin.H{"reset": true})
+	})
+
+	// Forces the status /health answers with, to watch the kubelet react
+	// to a failing liveness probe. DELETE goes back to the real checks.
+	g.PUT("/health-status", func(c *gin.Context) {
+		var body struct {
+			Status int `json:"status"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil || !validHealthStatus(body.Status) {
+			abortWithError(c, http.StatusBadRequest, codeInvalidRequest, `body must be {"status": <HTTP status 200-599>}`)
+			return
+		}
+		a.forcedHealthStatus.Store(int64(body.Status))
+		requestLog(c).Warn("health status forced via admin endpoint", "event", "health_status_forced", "status", body.Status, "client_ip", c.ClientIP())
+		c.JSON(http.StatusOK, gin.H{"forced_status": body.Status})
+	})
+	g.DELETE("/health-status", func(c *gin.Context) {
+		a.forcedHealthStatus.Store(0)
+		requestLog(c).Info("forced health status cleared via admin endpoint", "event", "health_status_reset", "client_ip", c.ClientIP())
+		c.JSON(http.StatusOK, gin.H{"forced_status": nil})
+	})
+}
+
+// requestShutdown wakes serveGraceful as if a signal had arrived. It
+// reports false if shutdown was already requested.
+func (a *app) requestShutdown() bool {
+	if !a.shutdownTriggered.CompareAndSwap(false, true) {
+		return false
+	}
+	close(a.shutdownRequested)
+	return true
+}
+
+// waitForShutdownRequest blocks until a signal arrives on quit or
+// requestShutdown is called, returning the signal (nil for a request).
+func (a *app) waitForShutdownRequest(quit <-chan os.Signal) os.Signal {
+	select {
+	case sig := <-quit:
+		slog.Info("received signal", "event", "signal_received", "signal", sig.String())
+		return sig
+	case <-a.shutdownRequested:
+		slog.Info("received shutdown request", "event", "signal_received", "signal", "admin")
+		return nil
+	}
+}
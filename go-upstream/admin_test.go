@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAdminShutdownDrainsAndStopsAccepting(t *testing.T) {
+	cfg := shutdownTestConfig()
+	cfg.EnableAdmin = true
+	cfg.Addr = freeAddr(t)
+	a := newApp(cfg)
+	srv := newHTTPServer(cfg, newRouter(a))
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+cfg.Addr+"/health")
+
+	// A pooled client can leave a spare, never-used connection behind, which
+	// Shutdown only treats as idle after 5s
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Post("http://"+cfg.Addr+"/admin/shutdown", "", nil)
+	if err != nil {
+		t.Fatalf("POST /admin/shutdown: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", resp.StatusCode)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveGraceful: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down after /admin/shutdown")
+	}
+	if !a.shuttingDown.Load() {
+		t.Error("drain flag not set")
+	}
+	if conn, err := net.DialTimeout("tcp", cfg.Addr, time.Second); err == nil {
+		conn.Close()
+		t.Error("server still accepting connections after shutdown")
+	}
+}
+
+func TestAdminShutdownRejectsSecondTrigger(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Graceful = true
+	cfg.EnableAdmin = true
+	r := newRouter(newApp(cfg))
+
+	for i, want := range []int{http.StatusAccepted, http.StatusConflict} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/shutdown", nil))
+		if w.Code != want {
+			t.Errorf("call %d: status = %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
+
+func TestAdminEndpointsRequireFlag(t *testing.T) {
+	r := newRouter(newApp(defaultConfig()))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/shutdown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status without ENABLE_ADMIN = %d, want 404", w.Code)
+	}
+}
+
+// startToggleServer serves cfg via serveGraceful with the admin API on and
+// a.exit stubbed to record its code instead of ending the test binary.
+func startToggleServer(t *testing.T, graceful bool) (*app, string, <-chan error, <-chan int) {
+	t.Helper()
+	cfg := shutdownTestConfig()
+	cfg.Graceful = graceful
+	cfg.EnableAdmin = true
+	cfg.Addr = freeAddr(t)
+	a := newApp(cfg)
+	exited := make(chan int, 1)
+	a.exit = func(code int) { exited <- code }
+	srv := newHTTPServer(cfg, newRouter(a))
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+cfg.Addr+"/health")
+	return a, "http://" + cfg.Addr, done, exited
+}
+
+func putGraceful(t *testing.T, base, body string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPut, base+"/admin/graceful", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	// Not pooled, so no spare connection holds up the drain for 5s
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("PUT /admin/graceful: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /admin/graceful status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestAdminToggleToAbruptExitsOnSignal(t *testing.T) {
+	a, base, done, exited := startToggleServer(t, true)
+	putGraceful(t, base, `{"graceful": false}`)
+	if a.graceful.Load() {
+		t.Fatal("graceful mode still on after PUT")
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+	select {
+	case code := <-exited:
+		if code != 128+int(syscall.SIGTERM) {
+			t.Errorf("exit code = %d, want %d", code, 128+int(syscall.SIGTERM))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("exit was not called after SIGTERM")
+	}
+	if err := <-done; !errors.Is(err, errAbruptExit) {
+		t.Errorf("serveGraceful = %v, want errAbruptExit", err)
+	}
+	if a.shuttingDown.Load() {
+		t.Error("abrupt path ran the graceful drain")
+	}
+}
+
+func TestAdminToggleToGracefulDrainsOnSignal(t *testing.T) {
+	a, base, done, exited := startToggleServer(t, false)
+	putGraceful(t, base, `{"graceful": true}`)
+
+	sendSignal(t, syscall.SIGTERM)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveGraceful: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not drain after SIGTERM")
+	}
+	select {
+	case code := <-exited:
+		t.Errorf("exit(%d) called in graceful mode", code)
+	default:
+	}
+	if !a.shuttingDown.Load() {
+		t.Error("drain flag not set")
+	}
+}
+
+func TestAdminGracefulRejectsBadBody(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EnableAdmin = true
+	r := newRouter(newApp(cfg))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/admin/graceful", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assertErrorEnvelope(t, w, codeInvalidRequest)
+}
+
+func TestAdminForcesHealthStatus(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EnableAdmin = true
+	r := newRouter(newApp(cfg))
+	send := func(method, body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/admin/health-status", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send(http.MethodPut, `{"status": 503}`); code != http.StatusOK {
+		t.Fatalf("PUT 503 = %d, want 200", code)
+	}
+	if got := statusOf(r, "/health"); got != http.StatusServiceUnavailable {
+		t.Errorf("/health while forced = %d, want 503", got)
+	}
+	if code := send(http.MethodPut, `{"status": 200}`); code != http.StatusOK {
+		t.Fatalf("PUT 200 = %d, want 200", code)
+	}
+	if got := statusOf(r, "/health"); got != http.StatusOK {
+		t.Errorf("/health after forcing 200 = %d, want 200", got)
+	}
+	if code := send(http.MethodPut, `{"status": 42}`); code != http.StatusBadRequest {
+		t.Errorf("PUT 42 = %d, want 400", code)
+	}
+	if code := send(http.MethodDelete, ""); code != http.StatusOK {
+		t.Fatalf("DELETE = %d, want 200", code)
+	}
+	if code, body := getHealth(t, r); code != http.StatusOK || body.Status != "healthy" {
+		t.Errorf("/health after reset = %d %+v, want the real healthy result", code, body)
+	}
+}
+
+func TestInitialHealthStatus(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.InitialHealthStatus = http.StatusServiceUnavailable
+	if got := statusOf(newRouter(newApp(cfg)), "/health"); got != http.StatusServiceUnavailable {
+		t.Errorf("/health with INITIAL_HEALTH_STATUS=503 = %d, want 503", got)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// authExempt reports whether path is called by the kubelet or a scraper,
+// neither of which should need the API key.
+func authExempt(path string) bool {
+	return probeRoute(path) || path == "/metrics" || path == "/prestop"
+}
+
+// requireAPIKey rejects requests whose X-API-Key doesn't match key with a
+// 401. The comparison is constant-time so response timing says nothing
+// about how much of a guess was right. An empty key disables auth.
+func requireAPIKey(key string) gin.HandlerFunc {
+	if key == "" {
+		return func(c *gin.Context) { c.Next() }
+	}
+	want := []byte(key)
+	return func(c *gin.Context) {
+		if authExempt(c.FullPath()) {
+			c.Next()
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(apiKeyHeader)), want) != 1 {
+			abortWithError(c, http.StatusUnauthorized, codeUnauthorized, "missing or invalid "+apiKeyHeader)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeyRequired(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.APIKey = "s3cret"
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	r := newRouter(newApp(cfg))
+
+	for _, tc := range []struct {
+		name, key string
+		want      int
+	}{
+		{"valid key", "s3cret", http.StatusOK},
+		{"missing key", "", http.StatusUnauthorized},
+		{"wrong key", "s3cre", http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+		if tc.key != "" {
+			req.Header.Set(apiKeyHeader, tc.key)
+		}
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, w.Code, tc.want)
+		}
+		if tc.want == http.StatusUnauthorized {
+			assertErrorEnvelope(t, w, codeUnauthorized)
+		}
+	}
+}
+
+func TestAPIKeyExemptsProbesAndMetrics(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.APIKey = "s3cret"
+	r := newRouter(newApp(cfg))
+	for _, path := range []string{"/health", "/ready", "/metrics"} {
+		if got := statusOf(r, path); got != http.StatusOK {
+			t.Errorf("%s without key = %d, want 200", path, got)
+		}
+	}
+}
+
+func TestNoAPIKeyMeansNoAuth(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	if got := statusOf(newRouter(newApp(cfg)), "/api/data"); got != http.StatusOK {
+		t.Errorf("/api/data without API_KEY configured = %d, want 200", got)
+	}
+}
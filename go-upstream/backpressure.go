@@ -0,0 +1,23 @@
+package main
+
+import "log/slog"
+
+// overloaded reports whether /ready should fail because inFlight is too
+// high. It trips above READY_MAX_INFLIGHT and only clears again at or below
+// READY_RESUME_INFLIGHT, so a pod hovering around one threshold doesn't
+// flap in and out of the Service endpoints. This only steers readiness;
+// MAX_CONCURRENT is what actually sheds load.
+func (a *app) overloaded(inFlight int64) bool {
+	high, low := int64(a.cfg.ReadyMaxInFlight), int64(a.cfg.ReadyResumeInFlight)
+	if high <= 0 {
+		return false
+	}
+	if a.readyOverloaded.Load() {
+		if inFlight <= low && a.readyOverloaded.CompareAndSwap(true, false) {
+			slog.Info("in-flight load back under the low watermark — ready again", "event", "readiness_recovered", "in_flight", inFlight, "low_watermark", low)
+		}
+	} else if inFlight > high && a.readyOverloaded.CompareAndSwap(false, true) {
+		slog.Warn("in-flight load over the high watermark — failing readiness", "event", "readiness_overloaded", "in_flight", inFlight, "high_watermark", high)
+	}
+	return a.readyOverloaded.Load()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadyBackpressureUsesWatermarks(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.ReadyMaxInFlight, cfg.ReadyResumeInFlight = 2, 1
+	a := newApp(cfg)
+	r := newRouter(a)
+	started := make(chan struct{})
+	r.GET("/hold", func(c *gin.Context) {
+		started <- struct{}{}
+		<-c.Request.Context().Done()
+	})
+
+	// hold starts a request that stays in flight until its release is called.
+	var releases []func()
+	hold := func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodGet, "/hold", nil).WithContext(ctx)
+		done := make(chan struct{})
+		go func() {
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			close(done)
+		}()
+		<-started
+		releases = append(releases, func() { cancel(); <-done })
+	}
+	release := func() {
+		releases[len(releases)-1]()
+		releases = releases[:len(releases)-1]
+	}
+	defer func() {
+		for len(releases) > 0 {
+			release()
+		}
+	}()
+
+	steps := []struct {
+		name   string
+		change func()
+		want   int
+	}{
+		{"at the high watermark", func() { hold(); hold() }, http.StatusOK},
+		{"above the high watermark", hold, http.StatusServiceUnavailable},
+		{"between the watermarks", release, http.StatusServiceUnavailable},
+		{"at the low watermark", release, http.StatusOK},
+		{"back up to the high watermark", hold, http.StatusOK},
+	}
+	for _, s := range steps {
+		s.change()
+		if got := statusOf(r, "/ready"); got != s.want {
+			t.Errorf("/ready %s (%d in flight) = %d, want %d", s.name, len(releases), got, s.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerStateMachine(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newCircuitBreaker(3, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	mustAllow := func(step string) {
+		t.Helper()
+		if err := b.allow(); err != nil {
+			t.Fatalf("%s: allow() = %v, want nil", step, err)
+		}
+	}
+	mustReject := func(step string) {
+		t.Helper()
+		if err := b.allow(); !errors.Is(err, errCircuitOpen) {
+			t.Fatalf("%s: allow() = %v, want errCircuitOpen", step, err)
+		}
+	}
+	wantState := func(step string, want breakerState) {
+		t.Helper()
+		if got := b.State(); got != want {
+			t.Fatalf("%s: state = %s, want %s", step, got, want)
+		}
+	}
+
+	// Failures below the threshold, or broken up by a success, keep it closed
+	for i := 0; i < 2; i++ {
+		mustAllow("closed")
+		b.record(true)
+	}
+	mustAllow("closed")
+	b.record(false)
+	wantState("after success", breakerClosed)
+
+	for i := 0; i < 3; i++ {
+		mustAllow("closed")
+		b.record(true)
+	}
+	wantState("after 3 failures", breakerOpen)
+	mustReject("open")
+
+	now = now.Add(10 * time.Second)
+	mustAllow("probe after cooldown")
+	wantState("probing", breakerHalfOpen)
+	mustReject("second concurrent probe")
+
+	b.record(true)
+	wantState("failed probe", breakerOpen)
+	mustReject("reopened")
+
+	now = now.Add(10 * time.Second)
+	mustAllow("second probe")
+	b.record(false)
+	wantState("successful probe", breakerClosed)
+	mustAllow("closed again")
+}
+
+func TestAPIDataFailsFastWhileCircuitOpen(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	cfg := defaultConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	cfg.UpstreamURL = backend.URL
+	cfg.UpstreamRetries = 0
+	a := newApp(cfg)
+	r := newRouter(a)
+
+	for i := 0; i < breakerFailureThreshold; i++ {
+		if got := statusOf(r, "/api/data"); got != http.StatusBadGateway {
+			t.Fatalf("request %d: status = %d, want 502", i+1, got)
+		}
+	}
+	if got := statusOf(r, "/api/data"); got != http.StatusServiceUnavailable {
+		t.Errorf("status with open circuit = %d, want 503", got)
+	}
+	if n := calls.Load(); n != breakerFailureThreshold {
+		t.Errorf("downstream calls = %d, want %d (none while open)", n, breakerFailureThreshold)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), "downstream_circuit_state 1") {
+		t.Error("/metrics does not report downstream_circuit_state 1")
+	}
+}
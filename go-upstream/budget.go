@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultGraceBudget matches the Kubernetes default
+// terminationGracePeriodSeconds.
+const defaultGraceBudget = 30 * time.Second
+
+// applyGraceBudget derives ShutdownTimeout from GraceBudget for
+// AUTO_BUDGET. The kubelet starts the grace period when it calls the
+// preStop hook, so the budget is spent in order on the preStop wait, then
+// the lame-duck window, then the HTTP drain. ShutdownTimeout covers the
+// last two, because the lame-duck window runs inside it.
+func (c *Config) applyGraceBudget() error {
+	prestop := c.prestopWait()
+	if used := prestop + c.LameDuckDelay; used >= c.GraceBudget {
+		return fmt.Errorf("the preStop wait (%s) + LAMEDUCK_DELAY (%s) leave nothing of GRACE_BUDGET (%s) to drain in-flight requests",
+			prestop, c.LameDuckDelay, c.GraceBudget)
+	}
+	c.ShutdownTimeout = c.GraceBudget - prestop
+	return nil
+}
+
+// prestopWait is the longest /prestop holds the kubelet: PRESTOP_DELAY,
+// capped at PRESTOP_MAX_DELAY when that is set.
+func (c Config) prestopWait() time.Duration {
+	if c.PrestopMaxDelay > 0 {
+		return min(c.PrestopDelay, c.PrestopMaxDelay)
+	}
+	return c.PrestopDelay
+}
+
+// budgetBreakdown reports how GraceBudget is split, for the startup log.
+func (c Config) budgetBreakdown() map[string]any {
+	return map[string]any{
+		"grace_budget":  c.GraceBudget.String(),
+		"prestop_delay": c.prestopWait().String(),
+		"lameduck":      c.LameDuckDelay.String(),
+		"drain":         (c.ShutdownTimeout - c.LameDuckDelay).String(),
+	}
+}
+
+// routeMax is the longest a route can run with the current configuration.
+type routeMax struct {
+	route string
+	max   time.Duration
+}
+
+// routeMaxDurations lists the routes whose running time is bounded by
+// configuration. Routes without a bound, such as /api/data with
+// API_DATA_TIMEOUT=0, are left out because there is nothing to compare.
+func (c Config) routeMaxDurations() []routeMax {
+	routes := []routeMax{
+		{"/prestop", c.prestopWait()},
+		{"/stream", streamChunks * streamChunkInterval},
+	}
+	if c.APIDataTimeout > 0 {
+		routes = append(routes, routeMax{"/api/data", c.APIDataTimeout})
+	}
+	return routes
+}
+
+// routeBudgetWarnings flags every route that could still be running when
+// SHUTDOWN_TIMEOUT expires, since such a request can't finish in the drain.
+func (c Config) routeBudgetWarnings() []string {
+	var w []string
+	for _, r := range c.routeMaxDurations() {
+		if r.max >= c.ShutdownTimeout {
+			w = append(w, fmt.Sprintf("%s may run for %s, not below SHUTDOWN_TIMEOUT (%s) — a request in flight at shutdown can't finish in the drain",
+				r.route, r.max, c.ShutdownTimeout))
+		}
+	}
+	return w
+}
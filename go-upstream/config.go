@@ -0,0 +1,645 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPort              = 7000
+	defaultShutdownTimeout   = 15 * time.Second
+	defaultPrestopDelay      = 5 * time.Second
+	defaultPrestopMaxDelay   = 20 * time.Second
+	defaultLameDuckDelay     = 5 * time.Second
+	defaultReadTimeout       = 10 * time.Second
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultWriteTimeout      = 10 * time.Second
+	defaultIdleTimeout       = 60 * time.Second
+	defaultMinLatencyMs      = 100
+	defaultMaxLatencyMs      = 200
+	// defaultTimeoutExitCode is EX_TEMPFAIL from sysexits.h.
+	defaultTimeoutExitCode = 75
+)
+
+// Config is the resolved runtime configuration. It is loaded from the
+// environment once at startup and passed by value from then on.
+type Config struct {
+	// Addr is the listen address built from HOST and PORT.
+	Addr string
+	// ListenSocket is a Unix socket path served instead of Addr when set.
+	ListenSocket string
+	// ReusePort binds Addr with SO_REUSEPORT (Linux only) so an old and a
+	// new process can overlap during a restart.
+	ReusePort bool
+	// DryRunShutdown makes shutdown signals rehearse the drain in the logs
+	// while the server keeps serving.
+	DryRunShutdown bool
+	// Graceful selects signal handling and draining (GRACEFUL=true).
+	Graceful bool
+	// ShutdownSignals is the raw comma-separated list of signals that
+	// start a graceful shutdown.
+	ShutdownSignals string
+	LogLevel        slog.Level
+	// LogProbes includes /health, /ready, and /startup in the access log.
+	LogProbes bool
+	// RequestLogSize is how many finished requests GET /admin/requests
+	// keeps; 0 keeps none.
+	RequestLogSize int
+
+	// TLSCertFile and TLSKeyFile switch serving to HTTPS when both are set.
+	TLSCertFile, TLSKeyFile string
+	// EnableH2C accepts HTTP/2 without TLS next to HTTP/1.1.
+	EnableH2C bool
+
+	// ShutdownTimeout bounds the drain after a shutdown signal.
+	ShutdownTimeout time.Duration
+	// TimeoutExitCode is the exit status when ShutdownTimeout runs out,
+	// so wrappers can tell a forced drain from a clean one (status 0).
+	TimeoutExitCode int
+	// AutoBudget derives ShutdownTimeout from GraceBudget, which should
+	// match the pod's terminationGracePeriodSeconds.
+	AutoBudget  bool
+	GraceBudget time.Duration
+	// PrestopDelay is how long /prestop sleeps while K8s removes the pod
+	// from the Service endpoints.
+	PrestopDelay time.Duration
+	// PrestopMaxDelay caps the /prestop wait whatever PrestopDelay says;
+	// 0 disables the cap.
+	PrestopMaxDelay time.Duration
+	// EndpointRemovalURL is polled by /prestop until it confirms the pod
+	// left the endpoint set; PrestopDelay then only caps the wait.
+	EndpointRemovalURL string
+	// ShutdownWebhookURL receives a POST when the drain starts and when
+	// it completes.
+	ShutdownWebhookURL string
+	// LameDuckDelay is how long requests keep being served after /ready
+	// fails, before the HTTP drain starts.
+	LameDuckDelay time.Duration
+	// StartupDelay is how long the process waits before binding, like a
+	// slow cold start.
+	StartupDelay time.Duration
+	// WarmupDelay is how long /startup fails after the process starts.
+	WarmupDelay time.Duration
+	// WarmupTimeout bounds the registered warmup hooks.
+	WarmupTimeout time.Duration
+	// HealthStaleness is how old the heartbeat may get before /health
+	// fails; 0 disables the check.
+	HealthStaleness time.Duration
+	// RuntimeSampleInterval is how often the goroutine and memory gauges
+	// are refreshed; 0 stops sampling after startup.
+	RuntimeSampleInterval time.Duration
+	// InitialHealthStatus, when non-zero, is the status /health returns
+	// from startup until /admin/health-status clears it.
+	InitialHealthStatus int
+	// HealthFormat is "json" or "text": how /health, /ready, and /version
+	// write their bodies.
+	HealthFormat string
+	// HealthCacheTTL is how long a /health result is reused; 0 runs the
+	// checks on every probe.
+	HealthCacheTTL time.Duration
+	// HealthCheckTimeout bounds each /health check; one still running is
+	// reported as "timeout".
+	HealthCheckTimeout time.Duration
+
+	ReadTimeout, WriteTimeout, IdleTimeout time.Duration
+	// ReadHeaderTimeout bounds how long a client may take to send headers,
+	// so slow-header connections can't pin the server open during drain.
+	ReadHeaderTimeout time.Duration
+	// MaxHeaderBytes caps the request header size.
+	MaxHeaderBytes int
+
+	// MinLatencyMs and MaxLatencyMs bound the simulated /api/data work.
+	MinLatencyMs, MaxLatencyMs int
+	// ErrorRate is the probability that /api/data returns a simulated 500.
+	ErrorRate float64
+	// APIDataTimeout is the deadline for /api/data before it returns 504.
+	APIDataTimeout time.Duration
+	// ExtraFields is a raw JSON object whose fields are added to every
+	// /api/data response.
+	ExtraFields string
+
+	// MaxBodyBytes caps request bodies on routes that read them.
+	MaxBodyBytes int
+	// PayloadBytes pads /api/data with a filler field of this many bytes;
+	// 0 keeps the small default payload.
+	PayloadBytes int
+	// GzipMinSize is the smallest response body worth compressing.
+	GzipMinSize int
+	// MaxConcurrent caps concurrently executing handlers; 0 means unlimited.
+	MaxConcurrent int
+	// MaxInflightBytes sheds new requests while the bytes read and
+	// written by those in flight reach it; 0 means unlimited.
+	MaxInflightBytes int
+	// MaxConns caps open connections by pausing accepts; 0 means unlimited.
+	MaxConns int
+	// NumWorkers sizes the /enqueue worker pool; 0 disables it.
+	NumWorkers int
+	// QueueWait is how long a request waits for a MAX_CONCURRENT slot
+	// before it is shed.
+	QueueWait time.Duration
+	// ReadyMaxInFlight is the in-flight count above which /ready fails, and
+	// ReadyResumeInFlight the count it must fall to before /ready passes
+	// again. A ReadyMaxInFlight of 0 disables the check.
+	ReadyMaxInFlight    int
+	ReadyResumeInFlight int
+	// RateLimitRPS and RateLimitBurst size each client IP's token bucket;
+	// an RPS of 0 disables rate limiting.
+	RateLimitRPS   float64
+	RateLimitBurst int
+	// CORSAllowedOrigins is the raw comma-separated CORS_ALLOWED_ORIGINS
+	// list; empty disables CORS.
+	CORSAllowedOrigins string
+	// EnablePprof mounts the pprof handlers under /debug/pprof.
+	EnablePprof bool
+	// EnableAdmin mounts the /admin endpoints.
+	EnableAdmin bool
+	// APIKey, when set, must be sent as X-API-Key on every request except
+	// probes, /metrics, and /prestop.
+	APIKey string
+	// StrictRoutes turns off redirecting paths that differ from a route
+	// only by a trailing slash or letter case.
+	StrictRoutes bool
+
+	// UpstreamURL is the optional service /api/data calls.
+	UpstreamURL string
+	// UpstreamRetries is how many times a failed downstream call is retried.
+	UpstreamRetries int
+	// UpstreamTimeout bounds each downstream call, retries included, so a
+	// slow downstream fails /api/data with 504 well before the request's
+	// own deadline; 0 leaves only that deadline.
+	UpstreamTimeout time.Duration
+	// CacheTTL is how long the last good downstream response is served
+	// when the downstream fails; 0 disables the fallback.
+	CacheTTL time.Duration
+	// OTLPEndpoint is where spans are exported; tracing is off when empty.
+	OTLPEndpoint string
+
+	// fallbacks holds the newline-separated warnings for env values that
+	// LoadConfig replaced with a default, reported by warnings(). It is a
+	// string so Config stays comparable.
+	fallbacks string
+}
+
+// defaultConfig returns the configuration used when no env vars are set.
+func defaultConfig() Config {
+	return Config{
+		Addr:                  ":" + strconv.Itoa(defaultPort),
+		LogLevel:              slog.LevelInfo,
+		ShutdownSignals:       defaultShutdownSignals,
+		ShutdownTimeout:       defaultShutdownTimeout,
+		TimeoutExitCode:       defaultTimeoutExitCode,
+		GraceBudget:           defaultGraceBudget,
+		PrestopDelay:          defaultPrestopDelay,
+		PrestopMaxDelay:       defaultPrestopMaxDelay,
+		LameDuckDelay:         defaultLameDuckDelay,
+		HealthStaleness:       defaultHealthStaleness,
+		HealthCacheTTL:        defaultHealthCacheTTL,
+		HealthFormat:          healthFormatJSON,
+		HealthCheckTimeout:    defaultHealthCheckTimeout,
+		RuntimeSampleInterval: defaultRuntimeSampleInterval,
+		WarmupTimeout:         defaultWarmupTimeout,
+		ReadTimeout:           defaultReadTimeout,
+		ReadHeaderTimeout:     defaultReadHeaderTimeout,
+		MaxHeaderBytes:        http.DefaultMaxHeaderBytes,
+		WriteTimeout:          defaultWriteTimeout,
+		IdleTimeout:           defaultIdleTimeout,
+		MinLatencyMs:          defaultMinLatencyMs,
+		MaxLatencyMs:          defaultMaxLatencyMs,
+		APIDataTimeout:        defaultAPIDataTimeout,
+		GzipMinSize:           defaultGzipMinSize,
+		UpstreamRetries:       defaultUpstreamRetries,
+		RateLimitBurst:        1,
+		MaxBodyBytes:          defaultMaxBodyBytes,
+		StrictRoutes:          true,
+		QueueWait:             defaultQueueWait,
+	}
+}
+
+// LoadConfig parses every env var once and applies defaults. All invalid
+// values are reported together in a single error.
+func LoadConfig() (Config, error) {
+	cfg := defaultConfig()
+	var p envParser
+
+	port := p.integer("PORT", defaultPort)
+	if port < 1 || port > 65535 {
+		p.fail("PORT", os.Getenv("PORT"), "must be between 1 and 65535")
+	}
+	// An empty HOST binds every interface
+	host := os.Getenv("HOST")
+	if host != "" && host != "localhost" && net.ParseIP(host) == nil {
+		p.fail("HOST", host, "must be an IP address or localhost")
+	}
+	cfg.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	cfg.ListenSocket = os.Getenv("LISTEN_SOCKET")
+	cfg.ReusePort = p.boolean("REUSE_PORT")
+
+	// Manifests predating strict parsing may say GRACEFUL=yes, which used
+	// to mean non-graceful, so an unrecognised value still doesn't fail
+	cfg.Graceful = p.booleanOrFalse("GRACEFUL")
+	cfg.DryRunShutdown = p.boolean("DRY_RUN_SHUTDOWN")
+	if raw := os.Getenv("SHUTDOWN_SIGNALS"); raw != "" {
+		cfg.ShutdownSignals = raw
+	}
+	cfg.LogProbes = p.boolean("LOG_PROBES")
+	cfg.RequestLogSize = p.integer("REQUEST_LOG_SIZE", 0)
+	if cfg.RequestLogSize < 0 {
+		p.fail("REQUEST_LOG_SIZE", os.Getenv("REQUEST_LOG_SIZE"), "must not be negative")
+	}
+	if raw := os.Getenv("LOG_LEVEL"); raw != "" {
+		lvl, ok := parseLogLevel(raw)
+		if !ok {
+			p.fail("LOG_LEVEL", raw, "must be one of debug, info, warn, error")
+		}
+		cfg.LogLevel = lvl
+	}
+
+	cfg.TLSCertFile, cfg.TLSKeyFile = os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		p.errs = append(p.errs, "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	cfg.EnableH2C = p.boolean("ENABLE_H2C")
+
+	cfg.ShutdownTimeout = p.positiveDurationOrDefault("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+	cfg.TimeoutExitCode = p.integer("TIMEOUT_EXIT_CODE", defaultTimeoutExitCode)
+	if cfg.TimeoutExitCode < 1 || cfg.TimeoutExitCode > 125 {
+		p.fail("TIMEOUT_EXIT_CODE", os.Getenv("TIMEOUT_EXIT_CODE"), "must be between 1 and 125")
+	}
+	cfg.PrestopDelay = p.duration("PRESTOP_DELAY", defaultPrestopDelay)
+	cfg.PrestopMaxDelay = p.duration("PRESTOP_MAX_DELAY", defaultPrestopMaxDelay)
+	cfg.LameDuckDelay = p.duration("LAMEDUCK_DELAY", defaultLameDuckDelay)
+	if raw := os.Getenv("ENDPOINT_REMOVAL_URL"); raw != "" {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.fail("ENDPOINT_REMOVAL_URL", redactURL(raw), "must be an absolute http(s) URL")
+		}
+		cfg.EndpointRemovalURL = raw
+	}
+	if raw := os.Getenv("SHUTDOWN_WEBHOOK_URL"); raw != "" {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.fail("SHUTDOWN_WEBHOOK_URL", redactURL(raw), "must be an absolute http(s) URL")
+		}
+		cfg.ShutdownWebhookURL = raw
+	}
+	cfg.AutoBudget = p.boolean("AUTO_BUDGET")
+	cfg.GraceBudget = p.duration("GRACE_BUDGET", defaultGraceBudget)
+	if cfg.AutoBudget {
+		if err := cfg.applyGraceBudget(); err != nil {
+			p.errs = append(p.errs, err.Error())
+		} else if raw := os.Getenv("SHUTDOWN_TIMEOUT"); raw != "" {
+			p.warns = append(p.warns, fmt.Sprintf("SHUTDOWN_TIMEOUT=%q is ignored with AUTO_BUDGET — using %s derived from GRACE_BUDGET", raw, cfg.ShutdownTimeout))
+		}
+	}
+	cfg.StartupDelay = p.duration("STARTUP_DELAY", 0)
+	cfg.WarmupDelay = p.duration("WARMUP_DELAY", 0)
+	cfg.WarmupTimeout = p.duration("WARMUP_TIMEOUT", defaultWarmupTimeout)
+	if cfg.WarmupTimeout == 0 {
+		p.fail("WARMUP_TIMEOUT", os.Getenv("WARMUP_TIMEOUT"), "must be positive")
+	}
+	cfg.HealthStaleness = p.duration("HEALTH_STALENESS", defaultHealthStaleness)
+	cfg.HealthCacheTTL = p.duration("HEALTH_CACHE_TTL", defaultHealthCacheTTL)
+	cfg.HealthCheckTimeout = p.duration("HEALTH_CHECK_TIMEOUT", defaultHealthCheckTimeout)
+	if cfg.HealthCheckTimeout <= 0 {
+		p.fail("HEALTH_CHECK_TIMEOUT", os.Getenv("HEALTH_CHECK_TIMEOUT"), "must be positive")
+	}
+	cfg.InitialHealthStatus = p.integer("INITIAL_HEALTH_STATUS", 0)
+	if cfg.InitialHealthStatus != 0 && !validHealthStatus(cfg.InitialHealthStatus) {
+		p.fail("INITIAL_HEALTH_STATUS", os.Getenv("INITIAL_HEALTH_STATUS"), "must be an HTTP status between 200 and 599")
+	}
+	if raw := os.Getenv("HEALTH_FORMAT"); raw != "" {
+		if raw != healthFormatJSON && raw != healthFormatText {
+			p.fail("HEALTH_FORMAT", raw, "must be json or text")
+		}
+		cfg.HealthFormat = raw
+	}
+	cfg.RuntimeSampleInterval = p.duration("RUNTIME_SAMPLE_INTERVAL", defaultRuntimeSampleInterval)
+	cfg.ReadTimeout = p.duration("READ_TIMEOUT", defaultReadTimeout)
+	cfg.ReadHeaderTimeout = p.duration("READ_HEADER_TIMEOUT", defaultReadHeaderTimeout)
+	cfg.MaxHeaderBytes = p.integer("MAX_HEADER_BYTES", http.DefaultMaxHeaderBytes)
+	if cfg.MaxHeaderBytes <= 0 {
+		p.fail("MAX_HEADER_BYTES", os.Getenv("MAX_HEADER_BYTES"), "must be positive")
+	}
+	cfg.WriteTimeout = p.duration("WRITE_TIMEOUT", defaultWriteTimeout)
+	cfg.IdleTimeout = p.duration("IDLE_TIMEOUT", defaultIdleTimeout)
+
+	cfg.MinLatencyMs = p.integer("MIN_LATENCY_MS", defaultMinLatencyMs)
+	cfg.MaxLatencyMs = p.integer("MAX_LATENCY_MS", defaultMaxLatencyMs)
+	if cfg.MinLatencyMs < 0 || cfg.MaxLatencyMs < 0 || cfg.MinLatencyMs > cfg.MaxLatencyMs {
+		p.warns = append(p.warns, fmt.Sprintf("latency range %d..%d ms: need 0 <= MIN_LATENCY_MS <= MAX_LATENCY_MS — using defaults %d..%d ms",
+			cfg.MinLatencyMs, cfg.MaxLatencyMs, defaultMinLatencyMs, defaultMaxLatencyMs))
+		cfg.MinLatencyMs, cfg.MaxLatencyMs = defaultMinLatencyMs, defaultMaxLatencyMs
+	}
+	cfg.APIDataTimeout = p.duration("API_DATA_TIMEOUT", defaultAPIDataTimeout)
+	cfg.ErrorRate = p.float("ERROR_RATE", 0)
+	// Written so NaN, which fails every comparison, is rejected too
+	if !(cfg.ErrorRate >= 0 && cfg.ErrorRate <= 1) {
+		p.fail("ERROR_RATE", os.Getenv("ERROR_RATE"), "must be between 0.0 and 1.0")
+	}
+	cfg.ExtraFields = os.Getenv("EXTRA_FIELDS")
+	if _, err := parseExtraFields(cfg.ExtraFields); err != nil {
+		p.fail("EXTRA_FIELDS", cfg.ExtraFields, "must be a JSON object: "+err.Error())
+	}
+
+	cfg.GzipMinSize = p.integer("GZIP_MIN_SIZE", defaultGzipMinSize)
+	cfg.PayloadBytes = p.integer("PAYLOAD_BYTES", 0)
+	if cfg.PayloadBytes < 0 {
+		p.fail("PAYLOAD_BYTES", os.Getenv("PAYLOAD_BYTES"), "must not be negative")
+	}
+	cfg.MaxBodyBytes = p.integer("MAX_BODY_BYTES", defaultMaxBodyBytes)
+	if cfg.MaxBodyBytes <= 0 {
+		p.fail("MAX_BODY_BYTES", os.Getenv("MAX_BODY_BYTES"), "must be positive")
+	}
+	cfg.MaxConcurrent = p.integer("MAX_CONCURRENT", 0)
+	if cfg.MaxConcurrent < 0 {
+		p.fail("MAX_CONCURRENT", os.Getenv("MAX_CONCURRENT"), "must not be negative")
+	}
+	cfg.QueueWait = p.duration("QUEUE_WAIT", defaultQueueWait)
+	cfg.MaxInflightBytes = p.integer("MAX_INFLIGHT_BYTES", 0)
+	if cfg.MaxInflightBytes < 0 {
+		p.fail("MAX_INFLIGHT_BYTES", os.Getenv("MAX_INFLIGHT_BYTES"), "must not be negative")
+	}
+	cfg.MaxConns = p.integer("MAX_CONNS", 0)
+	if cfg.MaxConns < 0 {
+		p.fail("MAX_CONNS", os.Getenv("MAX_CONNS"), "must not be negative")
+	}
+	cfg.NumWorkers = p.integer("NUM_WORKERS", 0)
+	if cfg.NumWorkers < 0 {
+		p.fail("NUM_WORKERS", os.Getenv("NUM_WORKERS"), "must not be negative")
+	}
+	cfg.ReadyMaxInFlight = p.integer("READY_MAX_INFLIGHT", 0)
+	cfg.ReadyResumeInFlight = p.integer("READY_RESUME_INFLIGHT", cfg.ReadyMaxInFlight/2)
+	if cfg.ReadyMaxInFlight < 0 {
+		p.fail("READY_MAX_INFLIGHT", os.Getenv("READY_MAX_INFLIGHT"), "must not be negative")
+	}
+	if cfg.ReadyMaxInFlight > 0 && (cfg.ReadyResumeInFlight < 0 || cfg.ReadyResumeInFlight >= cfg.ReadyMaxInFlight) {
+		p.fail("READY_RESUME_INFLIGHT", os.Getenv("READY_RESUME_INFLIGHT"), "must be at least 0 and below READY_MAX_INFLIGHT")
+	}
+	cfg.CORSAllowedOrigins = os.Getenv("CORS_ALLOWED_ORIGINS")
+	cfg.RateLimitRPS = p.float("RATE_LIMIT_RPS", 0)
+	cfg.RateLimitBurst = p.integer("RATE_LIMIT_BURST", int(math.Max(1, math.Ceil(cfg.RateLimitRPS))))
+	if cfg.RateLimitRPS < 0 {
+		p.fail("RATE_LIMIT_RPS", os.Getenv("RATE_LIMIT_RPS"), "must not be negative")
+	}
+	if cfg.RateLimitBurst < 1 {
+		p.fail("RATE_LIMIT_BURST", os.Getenv("RATE_LIMIT_BURST"), "must be at least 1")
+	}
+	cfg.EnablePprof = p.boolean("ENABLE_PPROF")
+	cfg.EnableAdmin = p.boolean("ENABLE_ADMIN")
+	cfg.APIKey = os.Getenv("API_KEY")
+	cfg.StrictRoutes = os.Getenv("STRICT_ROUTES") == "" || p.boolean("STRICT_ROUTES")
+
+	if raw := os.Getenv("UPSTREAM_URL"); raw != "" {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.fail("UPSTREAM_URL", redactURL(raw), "must be an absolute http(s) URL")
+		}
+		cfg.UpstreamURL = raw
+	}
+	cfg.UpstreamRetries = p.integer("UPSTREAM_RETRIES", defaultUpstreamRetries)
+	if cfg.UpstreamRetries < 0 || cfg.UpstreamRetries > maxUpstreamRetries {
+		p.fail("UPSTREAM_RETRIES", os.Getenv("UPSTREAM_RETRIES"), fmt.Sprintf("must be between 0 and %d", maxUpstreamRetries))
+	}
+	cfg.UpstreamTimeout = p.duration("UPSTREAM_TIMEOUT", 0)
+	if cfg.UpstreamTimeout < 0 {
+		p.fail("UPSTREAM_TIMEOUT", os.Getenv("UPSTREAM_TIMEOUT"), "must not be negative")
+	}
+	cfg.CacheTTL = p.duration("CACHE_TTL", 0)
+	if raw := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); raw != "" {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.fail("OTEL_EXPORTER_OTLP_ENDPOINT", redactURL(raw), "must be an absolute http(s) URL")
+		}
+		cfg.OTLPEndpoint = raw
+	}
+
+	if len(p.errs) > 0 {
+		return cfg, errors.New("invalid configuration: " + strings.Join(p.errs, "; "))
+	}
+	cfg.fallbacks = strings.Join(p.warns, "\n")
+	return cfg, nil
+}
+
+// parseExtraFields decodes EXTRA_FIELDS. An empty string means no extra
+// fields.
+func parseExtraFields(raw string) (map[string]any, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, errors.New("null is not an object")
+	}
+	return fields, nil
+}
+
+// warnings lists values LoadConfig replaced with a default, then settings
+// that are valid on their own but likely to cause trouble in combination.
+func (c Config) warnings() []string {
+	var w []string
+	if c.fallbacks != "" {
+		w = append(w, strings.Split(c.fallbacks, "\n")...)
+	}
+	w = append(w, c.routeBudgetWarnings()...)
+	if c.PrestopMaxDelay > 0 && c.PrestopDelay > c.PrestopMaxDelay {
+		w = append(w, "PRESTOP_DELAY exceeds PRESTOP_MAX_DELAY — /prestop will return after PRESTOP_MAX_DELAY")
+	}
+	if c.LameDuckDelay >= c.ShutdownTimeout {
+		w = append(w, "LAMEDUCK_DELAY is not below SHUTDOWN_TIMEOUT — no time is left to drain in-flight requests")
+	}
+	sigs, unknown := parseSignals(c.ShutdownSignals)
+	for _, name := range unknown {
+		w = append(w, fmt.Sprintf("SHUTDOWN_SIGNALS: unknown signal %s skipped", name))
+	}
+	if len(sigs) == 0 {
+		w = append(w, "SHUTDOWN_SIGNALS names no usable signal — falling back to "+defaultShutdownSignals)
+	}
+	return w
+}
+
+// redacted reports the configuration for /config and the startup log. File
+// paths are reduced to booleans and URL credentials are masked.
+func (c Config) redacted() map[string]any {
+	return map[string]any{
+		"addr":                    c.Addr,
+		"listen_socket":           c.ListenSocket,
+		"reuse_port":              c.ReusePort,
+		"graceful":                c.Graceful,
+		"dry_run_shutdown":        c.DryRunShutdown,
+		"shutdown_signals":        c.ShutdownSignals,
+		"tls_enabled":             c.TLSCertFile != "",
+		"h2c_enabled":             c.EnableH2C,
+		"log_level":               strings.ToLower(c.LogLevel.String()),
+		"log_probes":              c.LogProbes,
+		"request_log_size":        c.RequestLogSize,
+		"shutdown_timeout":        c.ShutdownTimeout.String(),
+		"auto_budget":             c.AutoBudget,
+		"grace_budget":            c.GraceBudget.String(),
+		"prestop_delay":           c.PrestopDelay.String(),
+		"prestop_max_delay":       c.PrestopMaxDelay.String(),
+		"endpoint_removal_url":    redactURL(c.EndpointRemovalURL),
+		"shutdown_webhook_url":    redactURL(c.ShutdownWebhookURL),
+		"lameduck_delay":          c.LameDuckDelay.String(),
+		"read_timeout":            c.ReadTimeout.String(),
+		"read_header_timeout":     c.ReadHeaderTimeout.String(),
+		"max_header_bytes":        c.MaxHeaderBytes,
+		"write_timeout":           c.WriteTimeout.String(),
+		"idle_timeout":            c.IdleTimeout.String(),
+		"startup_delay":           c.StartupDelay.String(),
+		"warmup_delay":            c.WarmupDelay.String(),
+		"warmup_timeout":          c.WarmupTimeout.String(),
+		"health_staleness":        c.HealthStaleness.String(),
+		"health_cache_ttl":        c.HealthCacheTTL.String(),
+		"health_check_timeout":    c.HealthCheckTimeout.String(),
+		"initial_health_status":   c.InitialHealthStatus,
+		"health_format":           c.HealthFormat,
+		"runtime_sample_interval": c.RuntimeSampleInterval.String(),
+		"min_latency_ms":          c.MinLatencyMs,
+		"max_latency_ms":          c.MaxLatencyMs,
+		"extra_fields":            c.ExtraFields,
+		"error_rate":              c.ErrorRate,
+		"api_data_timeout":        c.APIDataTimeout.String(),
+		"gzip_min_size":           c.GzipMinSize,
+		"payload_bytes":           c.PayloadBytes,
+		"max_body_bytes":          c.MaxBodyBytes,
+		"max_concurrent":          c.MaxConcurrent,
+		"max_conns":               c.MaxConns,
+		"max_inflight_bytes":      c.MaxInflightBytes,
+		"num_workers":             c.NumWorkers,
+		"queue_wait":              c.QueueWait.String(),
+		"ready_max_inflight":      c.ReadyMaxInFlight,
+		"ready_resume_inflight":   c.ReadyResumeInFlight,
+		"rate_limit_rps":          c.RateLimitRPS,
+		"rate_limit_burst":        c.RateLimitBurst,
+		"pprof_enabled":           c.EnablePprof,
+		"admin_enabled":           c.EnableAdmin,
+		"api_key_set":             c.APIKey != "",
+		"strict_routes":           c.StrictRoutes,
+		"cors_allowed_origins":    c.CORSAllowedOrigins,
+		"upstream_url":            redactURL(c.UpstreamURL),
+		"cache_ttl":               c.CacheTTL.String(),
+		"upstream_retries":        c.UpstreamRetries,
+		"upstream_timeout":        c.UpstreamTimeout.String(),
+		"otlp_endpoint":           redactURL(c.OTLPEndpoint),
+	}
+}
+
+// redactURL masks any userinfo password in raw.
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "invalid"
+	}
+	return u.Redacted()
+}
+
+// envParser reads typed env vars, recording every invalid value instead of
+// stopping at the first one. Values that fall back to a default are
+// recorded in warns rather than errs.
+type envParser struct {
+	errs  []string
+	warns []string
+}
+
+func (p *envParser) fail(key, raw, reason string) {
+	p.errs = append(p.errs, fmt.Sprintf("%s=%q: %s", key, raw, reason))
+}
+
+func (p *envParser) duration(key string, def time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		p.fail(key, raw, "not a duration (e.g. \"20s\")")
+		return def
+	}
+	if d < 0 {
+		p.fail(key, raw, "must not be negative")
+		return def
+	}
+	return d
+}
+
+// positiveDurationOrDefault is duration for settings where a bad value
+// should not stop startup: anything unparsable or not positive is warned
+// about and replaced with def.
+func (p *envParser) positiveDurationOrDefault(key string, def time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		p.warns = append(p.warns, fmt.Sprintf("%s=%q: must be a positive duration — using default %s", key, raw, def))
+		return def
+	}
+	return d
+}
+
+func (p *envParser) integer(key string, def int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		p.fail(key, raw, "not an integer")
+		return def
+	}
+	return n
+}
+
+func (p *envParser) float(key string, def float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		p.fail(key, raw, "not a number")
+		return def
+	}
+	return f
+}
+
+// booleanOrFalse is boolean for settings that never failed startup: an
+// unparsable value is warned about and read as false.
+func (p *envParser) booleanOrFalse(key string) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		p.warns = append(p.warns, fmt.Sprintf("%s=%q: not a boolean — treating it as false", key, raw))
+		return false
+	}
+	return b
+}
+
+func (p *envParser) boolean(key string) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		p.fail(key, raw, "not a boolean")
+		return false
+	}
+	return b
+}
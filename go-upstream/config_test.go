@@ -0,0 +1,337 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg != defaultConfig() {
+		t.Errorf("LoadConfig() = %+v, want defaults %+v", cfg, defaultConfig())
+	}
+	if cfg.Addr != ":7000" || cfg.ShutdownTimeout != 15*time.Second || cfg.PrestopDelay != 5*time.Second {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	env := map[string]string{
+		"PORT":                        "8080",
+		"HOST":                        "127.0.0.1",
+		"LISTEN_SOCKET":               "/run/app.sock",
+		"REUSE_PORT":                  "true",
+		"GRACEFUL":                    "true",
+		"DRY_RUN_SHUTDOWN":            "true",
+		"SHUTDOWN_SIGNALS":            "SIGTERM,SIGUSR1",
+		"LOG_LEVEL":                   "debug",
+		"LOG_PROBES":                  "true",
+		"REQUEST_LOG_SIZE":            "50",
+		"TLS_CERT_FILE":               "cert.pem",
+		"ENABLE_H2C":                  "true",
+		"TLS_KEY_FILE":                "key.pem",
+		"SHUTDOWN_TIMEOUT":            "20s",
+		"TIMEOUT_EXIT_CODE":           "3",
+		"GRACE_BUDGET":                "45s",
+		"PRESTOP_DELAY":               "3s",
+		"PRESTOP_MAX_DELAY":           "15s",
+		"ENDPOINT_REMOVAL_URL":        "http://mesh-control:9000/removed?pod=a",
+		"SHUTDOWN_WEBHOOK_URL":        "http://hooks:8000/drain",
+		"LAMEDUCK_DELAY":              "2s",
+		"STARTUP_DELAY":               "2s",
+		"WARMUP_DELAY":                "1s",
+		"WARMUP_TIMEOUT":              "7s",
+		"HEALTH_STALENESS":            "9s",
+		"HEALTH_CACHE_TTL":            "250ms",
+		"HEALTH_FORMAT":               "text",
+		"HEALTH_CHECK_TIMEOUT":        "500ms",
+		"INITIAL_HEALTH_STATUS":       "503",
+		"RUNTIME_SAMPLE_INTERVAL":     "2s",
+		"READ_TIMEOUT":                "2s",
+		"READ_HEADER_TIMEOUT":         "1s",
+		"MAX_HEADER_BYTES":            "8192",
+		"WRITE_TIMEOUT":               "4s",
+		"IDLE_TIMEOUT":                "30s",
+		"MIN_LATENCY_MS":              "5",
+		"MAX_LATENCY_MS":              "10",
+		"ERROR_RATE":                  "0.25",
+		"EXTRA_FIELDS":                `{"region":"us-east-1"}`,
+		"API_DATA_TIMEOUT":            "1s",
+		"GZIP_MIN_SIZE":               "1024",
+		"PAYLOAD_BYTES":               "4096",
+		"MAX_BODY_BYTES":              "4096",
+		"MAX_CONCURRENT":              "8",
+		"MAX_CONNS":                   "64",
+		"MAX_INFLIGHT_BYTES":          "1048576",
+		"NUM_WORKERS":                 "3",
+		"QUEUE_WAIT":                  "1s",
+		"READY_MAX_INFLIGHT":          "20",
+		"READY_RESUME_INFLIGHT":       "5",
+		"RATE_LIMIT_RPS":              "2.5",
+		"RATE_LIMIT_BURST":            "10",
+		"ENABLE_PPROF":                "true",
+		"ENABLE_ADMIN":                "true",
+		"API_KEY":                     "s3cret",
+		"STRICT_ROUTES":               "false",
+		"CORS_ALLOWED_ORIGINS":        "https://dash.example.com",
+		"UPSTREAM_URL":                "http://downstream:8000/",
+		"UPSTREAM_RETRIES":            "4",
+		"UPSTREAM_TIMEOUT":            "750ms",
+		"CACHE_TTL":                   "1m",
+		"OTEL_EXPORTER_OTLP_ENDPOINT": "http://otel-collector:4318",
+	}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	want := Config{
+		Addr:                  "127.0.0.1:8080",
+		ListenSocket:          "/run/app.sock",
+		ReusePort:             true,
+		Graceful:              true,
+		DryRunShutdown:        true,
+		ShutdownSignals:       "SIGTERM,SIGUSR1",
+		LogLevel:              slog.LevelDebug,
+		LogProbes:             true,
+		RequestLogSize:        50,
+		TLSCertFile:           "cert.pem",
+		TLSKeyFile:            "key.pem",
+		EnableH2C:             true,
+		ShutdownTimeout:       20 * time.Second,
+		TimeoutExitCode:       3,
+		GraceBudget:           45 * time.Second,
+		PrestopDelay:          3 * time.Second,
+		PrestopMaxDelay:       15 * time.Second,
+		EndpointRemovalURL:    "http://mesh-control:9000/removed?pod=a",
+		ShutdownWebhookURL:    "http://hooks:8000/drain",
+		LameDuckDelay:         2 * time.Second,
+		StartupDelay:          2 * time.Second,
+		WarmupDelay:           time.Second,
+		WarmupTimeout:         7 * time.Second,
+		HealthStaleness:       9 * time.Second,
+		HealthCacheTTL:        250 * time.Millisecond,
+		HealthFormat:          "text",
+		HealthCheckTimeout:    500 * time.Millisecond,
+		InitialHealthStatus:   503,
+		RuntimeSampleInterval: 2 * time.Second,
+		ReadTimeout:           2 * time.Second,
+		ReadHeaderTimeout:     time.Second,
+		MaxHeaderBytes:        8192,
+		WriteTimeout:          4 * time.Second,
+		IdleTimeout:           30 * time.Second,
+		MinLatencyMs:          5,
+		MaxLatencyMs:          10,
+		ErrorRate:             0.25,
+		ExtraFields:           `{"region":"us-east-1"}`,
+		APIDataTimeout:        time.Second,
+		GzipMinSize:           1024,
+		PayloadBytes:          4096,
+		MaxBodyBytes:          4096,
+		MaxConcurrent:         8,
+		MaxConns:              64,
+		MaxInflightBytes:      1 << 20,
+		NumWorkers:            3,
+		QueueWait:             time.Second,
+		ReadyMaxInFlight:      20,
+		ReadyResumeInFlight:   5,
+		RateLimitRPS:          2.5,
+		RateLimitBurst:        10,
+		EnablePprof:           true,
+		EnableAdmin:           true,
+		APIKey:                "s3cret",
+		StrictRoutes:          false,
+		CORSAllowedOrigins:    "https://dash.example.com",
+		UpstreamURL:           "http://downstream:8000/",
+		UpstreamRetries:       4,
+		UpstreamTimeout:       750 * time.Millisecond,
+		CacheTTL:              time.Minute,
+		OTLPEndpoint:          "http://otel-collector:4318",
+	}
+	if cfg != want {
+		t.Errorf("LoadConfig() = %+v\nwant %+v", cfg, want)
+	}
+}
+
+func TestAutoBudgetAllocatesGraceBudget(t *testing.T) {
+	t.Setenv("AUTO_BUDGET", "true")
+	t.Setenv("GRACE_BUDGET", "40s")
+	t.Setenv("PRESTOP_DELAY", "8s")
+	t.Setenv("LAMEDUCK_DELAY", "4s")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.ShutdownTimeout != 32*time.Second {
+		t.Errorf("ShutdownTimeout = %s, want 32s", cfg.ShutdownTimeout)
+	}
+	drain := cfg.ShutdownTimeout - cfg.LameDuckDelay
+	if sum := cfg.PrestopDelay + cfg.LameDuckDelay + drain; sum != cfg.GraceBudget {
+		t.Errorf("prestop + lameduck + drain = %s, want the %s budget", sum, cfg.GraceBudget)
+	}
+	if got := cfg.budgetBreakdown()["drain"]; got != "28s" {
+		t.Errorf("breakdown drain = %v, want 28s", got)
+	}
+}
+
+func TestAutoBudgetUsesCappedPrestopAndWarnsOnShutdownTimeout(t *testing.T) {
+	t.Setenv("AUTO_BUDGET", "true")
+	t.Setenv("GRACE_BUDGET", "30s")
+	t.Setenv("PRESTOP_DELAY", "20s")
+	t.Setenv("PRESTOP_MAX_DELAY", "5s")
+	t.Setenv("LAMEDUCK_DELAY", "4s")
+	t.Setenv("SHUTDOWN_TIMEOUT", "10s")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.ShutdownTimeout != 25*time.Second {
+		t.Errorf("ShutdownTimeout = %s, want 25s left after the 5s capped preStop wait", cfg.ShutdownTimeout)
+	}
+	var found bool
+	for _, w := range cfg.warnings() {
+		found = found || strings.Contains(w, "SHUTDOWN_TIMEOUT=\"10s\" is ignored")
+	}
+	if !found {
+		t.Errorf("warnings() = %v, want one about the ignored SHUTDOWN_TIMEOUT", cfg.warnings())
+	}
+}
+
+func TestAutoBudgetRejectsOverAllocation(t *testing.T) {
+	t.Setenv("AUTO_BUDGET", "true")
+	t.Setenv("GRACE_BUDGET", "10s")
+	t.Setenv("PRESTOP_DELAY", "6s")
+	t.Setenv("LAMEDUCK_DELAY", "4s")
+	_, err := LoadConfig()
+	if err == nil || !strings.Contains(err.Error(), "GRACE_BUDGET") {
+		t.Fatalf("LoadConfig() error = %v, want a GRACE_BUDGET over-allocation error", err)
+	}
+}
+
+func TestLoadConfigCombinesErrors(t *testing.T) {
+	env := map[string]string{
+		"PORT":                        "70000",
+		"HOST":                        "not a host",
+		"INITIAL_HEALTH_STATUS":       "42",
+		"LOG_LEVEL":                   "loud",
+		"HEALTH_FORMAT":               "xml",
+		"TLS_CERT_FILE":               "cert.pem",
+		"PRESTOP_DELAY":               "-1s",
+		"ERROR_RATE":                  "1.5",
+		"UPSTREAM_RETRIES":            "1000",
+		"EXTRA_FIELDS":                `["region"]`,
+		"ENABLE_PPROF":                "maybe",
+		"UPSTREAM_URL":                "downstream:8000",
+		"OTEL_EXPORTER_OTLP_ENDPOINT": "otel-collector:4318",
+	}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+
+	_, err := LoadConfig()
+	if err == nil {
+		t.Fatal("LoadConfig() = nil error, want combined validation error")
+	}
+	msg := err.Error()
+	for _, key := range []string{
+		"PORT", "HOST", "INITIAL_HEALTH_STATUS", "LOG_LEVEL", "HEALTH_FORMAT", "TLS_CERT_FILE", "PRESTOP_DELAY",
+		"ERROR_RATE", "UPSTREAM_RETRIES", "EXTRA_FIELDS", "ENABLE_PPROF", "UPSTREAM_URL",
+		"OTEL_EXPORTER_OTLP_ENDPOINT",
+	} {
+		if !strings.Contains(msg, key) {
+			t.Errorf("error does not mention %s: %s", key, msg)
+		}
+	}
+}
+
+func TestLoadConfigRejectsErrorRateOutsideZeroToOne(t *testing.T) {
+	for _, raw := range []string{"-0.1", "1.5", "NaN", "Inf"} {
+		t.Setenv("ERROR_RATE", raw)
+		if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "ERROR_RATE") {
+			t.Errorf("ERROR_RATE=%q: LoadConfig() error = %v, want an ERROR_RATE error", raw, err)
+		}
+	}
+}
+
+func TestLoadConfigReadsUnrecognisedGracefulAsFalse(t *testing.T) {
+	t.Setenv("GRACEFUL", "yes")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("GRACEFUL=yes: LoadConfig() error = %v, want a warning only", err)
+	}
+	if cfg.Graceful {
+		t.Error("GRACEFUL=yes enabled graceful mode, want it off as before")
+	}
+	if w := cfg.warnings(); len(w) != 1 || !strings.Contains(w[0], "GRACEFUL") {
+		t.Errorf("warnings() = %v, want one GRACEFUL warning", w)
+	}
+}
+
+func TestLoadConfigFallsBackOnBadShutdownTimeout(t *testing.T) {
+	for _, raw := range []string{"soon", "-5s", "0s"} {
+		t.Setenv("SHUTDOWN_TIMEOUT", raw)
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("SHUTDOWN_TIMEOUT=%q: LoadConfig() error = %v, want a fallback", raw, err)
+		}
+		if cfg.ShutdownTimeout != defaultShutdownTimeout {
+			t.Errorf("SHUTDOWN_TIMEOUT=%q: ShutdownTimeout = %s, want %s", raw, cfg.ShutdownTimeout, defaultShutdownTimeout)
+		}
+		if w := cfg.warnings(); len(w) != 1 || !strings.Contains(w[0], "SHUTDOWN_TIMEOUT") {
+			t.Errorf("SHUTDOWN_TIMEOUT=%q: warnings() = %v, want one SHUTDOWN_TIMEOUT warning", raw, w)
+		}
+	}
+}
+
+func TestLoadConfigFallsBackOnBadLatencyRange(t *testing.T) {
+	for _, env := range [][2]string{{"300", "200"}, {"-1", "200"}} {
+		t.Setenv("MIN_LATENCY_MS", env[0])
+		t.Setenv("MAX_LATENCY_MS", env[1])
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("latency %s..%s: LoadConfig() error = %v, want a fallback", env[0], env[1], err)
+		}
+		if cfg.MinLatencyMs != defaultMinLatencyMs || cfg.MaxLatencyMs != defaultMaxLatencyMs {
+			t.Errorf("latency %s..%s: got %d..%d, want the defaults %d..%d", env[0], env[1],
+				cfg.MinLatencyMs, cfg.MaxLatencyMs, defaultMinLatencyMs, defaultMaxLatencyMs)
+		}
+		if w := cfg.warnings(); len(w) != 1 || !strings.Contains(w[0], "latency range") {
+			t.Errorf("latency %s..%s: warnings() = %v, want one latency range warning", env[0], env[1], w)
+		}
+	}
+}
+
+func TestConfigWarnsWhenPrestopExceedsShutdownTimeout(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.PrestopDelay = 20 * time.Second
+	if len(cfg.warnings()) != 1 {
+		t.Errorf("warnings() = %v, want one prestop warning", cfg.warnings())
+	}
+	if w := defaultConfig().warnings(); len(w) != 0 {
+		t.Errorf("defaults produced warnings: %v", w)
+	}
+}
+
+func TestConfigWarnsWhenRouteMaxReachesShutdownTimeout(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.ShutdownTimeout = 4 * time.Second
+	cfg.LameDuckDelay = time.Second
+	cfg.PrestopDelay = 5 * time.Second
+	w := cfg.warnings()
+	if len(w) != 1 || !strings.HasPrefix(w[0], "/prestop may run for 5s") {
+		t.Errorf("warnings() = %v, want one /prestop route warning", w)
+	}
+
+	cfg.PrestopMaxDelay = 2 * time.Second
+	if w := cfg.warnings(); len(w) != 1 || strings.Contains(w[0], "/prestop may run") {
+		t.Errorf("warnings() with PRESTOP_MAX_DELAY below SHUTDOWN_TIMEOUT = %v, want only the cap warning", w)
+	}
+}
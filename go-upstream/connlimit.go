@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// limitListener stops accepting once max connections are open and resumes
+// as they close. Connections past the limit wait in the kernel's accept
+// backlog rather than being refused, so a burst is delayed, not failed,
+// and the drain never has more than max connections to wait on.
+type limitListener struct {
+	net.Listener
+	slots     chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// limitConns wraps l so at most max connections are open at once; a max
+// of 0 returns l unchanged.
+func limitConns(l net.Listener, max int) net.Listener {
+	if max <= 0 {
+		return l
+	}
+	return &limitListener{Listener: l, slots: make(chan struct{}, max), done: make(chan struct{})}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		slog.Warn("connection limit reached — deferring accepts", "event", "conn_limit_reached", "max_conns", cap(l.slots))
+		select {
+		case l.slots <- struct{}{}:
+		case <-l.done:
+			return nil, net.ErrClosed
+		}
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	return &limitedConn{Conn: c, release: func() { <-l.slots }}, nil
+}
+
+// Close also unblocks an Accept waiting for a slot.
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitedConn gives its slot back on the first Close, including when a
+// hijacked WebSocket or h2c connection is closed by its handler.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// sendHealth writes a GET /health on conn and reads the response, giving up
+// after wait.
+func sendHealth(conn net.Conn, wait time.Duration) error {
+	conn.SetDeadline(time.Now().Add(wait))
+	if _, err := conn.Write([]byte("GET /health HTTP/1.1\r\nHost: test\r\n\r\n")); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestMaxConnsDefersAcceptsPastLimit(t *testing.T) {
+	logs := captureLogs(t)
+	a := newApp(defaultConfig())
+	srv := httptest.NewUnstartedServer(newRouter(a))
+	srv.Listener = limitConns(srv.Listener, 2)
+	srv.Start()
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+
+	var held []net.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("dial %d: %v", i, err)
+		}
+		defer conn.Close()
+		if err := sendHealth(conn, 2*time.Second); err != nil {
+			t.Fatalf("request on connection %d: %v", i, err)
+		}
+		held = append(held, conn)
+	}
+
+	// The dial itself completes against the kernel backlog; the request
+	// just goes unanswered while the server is at the limit
+	extra, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial past limit: %v", err)
+	}
+	defer extra.Close()
+	if err := sendHealth(extra, 200*time.Millisecond); err == nil {
+		t.Fatal("connection past MAX_CONNS was served")
+	}
+	waitForLog(t, logs, "conn_limit_reached")
+
+	// Freeing a slot lets the waiting connection in and its request is served
+	held[0].Close()
+	extra.SetDeadline(time.Now().Add(2 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(extra), nil)
+	if err != nil {
+		t.Fatalf("connection was not accepted after another one closed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("deferred request = %d, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// connTracker counts connections by http.ConnState. New, active, and idle
+// are current counts; closed and hijacked only ever grow. Idle keep-alive
+// connections in particular explain a Shutdown that seems to wait on
+// nothing.
+type connTracker struct {
+	// states holds the last known state of every open connection.
+	states sync.Map // net.Conn -> http.ConnState
+
+	new, active, idle atomic.Int64
+	closed, hijacked  atomic.Int64
+}
+
+// track is installed as srv.ConnState.
+func (t *connTracker) track(c net.Conn, state http.ConnState) {
+	if prev, ok := t.states.Load(c); ok {
+		t.counter(prev.(http.ConnState)).Add(-1)
+	}
+	t.counter(state).Add(1)
+	if state == http.StateClosed || state == http.StateHijacked {
+		t.states.Delete(c)
+	} else {
+		t.states.Store(c, state)
+	}
+	slog.Debug("connection state changed", "event", "conn_state", "remote_addr", c.RemoteAddr().String(), "state", state.String())
+}
+
+func (t *connTracker) counter(state http.ConnState) *atomic.Int64 {
+	switch state {
+	case http.StateNew:
+		return &t.new
+	case http.StateActive:
+		return &t.active
+	case http.StateIdle:
+		return &t.idle
+	case http.StateHijacked:
+		return &t.hijacked
+	default:
+		return &t.closed
+	}
+}
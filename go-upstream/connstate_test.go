@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForConns polls until cond holds for the tracker or fails the test.
+func waitForConns(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConnStateCountersFollowConnection(t *testing.T) {
+	a := newApp(defaultConfig())
+	r := newRouter(a)
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.ConnState = a.conns.track
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	waitForConns(t, "new connection", func() bool { return a.conns.new.Load() == 1 })
+
+	if _, err := conn.Write([]byte("GET /health HTTP/1.1\r\nHost: test\r\n\r\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	resp.Body.Close()
+	waitForConns(t, "idle keep-alive connection", func() bool {
+		return a.conns.idle.Load() == 1 && a.conns.new.Load() == 0 && a.conns.active.Load() == 0
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `http_connections{state="idle"} 1`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("/metrics missing %q", want)
+	}
+
+	conn.Close()
+	waitForConns(t, "closed connection", func() bool { return a.conns.closed.Load() == 1 && a.conns.idle.Load() == 0 })
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	corsAllowMethods = "GET, POST, OPTIONS"
+	corsMaxAge       = "600"
+)
+
+// cors lets browsers on the listed origins call the API. allowed is the
+// raw CORS_ALLOWED_ORIGINS value: comma-separated origins, or "*" for any.
+// An empty list disables CORS entirely, so no headers are added.
+func cors(allowed string) gin.HandlerFunc {
+	origins := map[string]bool{}
+	for _, o := range strings.Split(allowed, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins[o] = true
+		}
+	}
+	if len(origins) == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	wildcard := origins["*"]
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || (!wildcard && !origins[origin]) {
+			c.Next()
+			return
+		}
+
+		if wildcard {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		c.Header("Access-Control-Expose-Headers", requestIDHeader)
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", corsAllowMethods)
+			if h := c.GetHeader("Access-Control-Request-Headers"); h != "" {
+				c.Header("Access-Control-Allow-Headers", h)
+			}
+			c.Header("Access-Control-Max-Age", corsMaxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func corsRouter(origins string) http.Handler {
+	cfg := defaultConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	cfg.CORSAllowedOrigins = origins
+	return newRouter(newApp(cfg))
+}
+
+func TestCORSPreflight(t *testing.T) {
+	r := corsRouter("https://dash.example.com, https://other.example.com")
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/data", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "X-Request-ID")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want 204", w.Code)
+	}
+	for h, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://dash.example.com",
+		"Access-Control-Allow-Methods": corsAllowMethods,
+		"Access-Control-Allow-Headers": "X-Request-ID",
+		"Access-Control-Max-Age":       corsMaxAge,
+	} {
+		if got := w.Header().Get(h); got != want {
+			t.Errorf("%s = %q, want %q", h, got, want)
+		}
+	}
+}
+
+func TestCORSSimpleGetFromAllowedOrigin(t *testing.T) {
+	cases := []struct {
+		name, origins, origin, want string
+	}{
+		{"listed origin", "https://dash.example.com", "https://dash.example.com", "https://dash.example.com"},
+		{"wildcard", "*", "https://anywhere.example.com", "*"},
+		{"unlisted origin", "https://dash.example.com", "https://evil.example.com", ""},
+		{"disabled", "", "https://dash.example.com", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+			req.Header.Set("Origin", tc.origin)
+			w := httptest.NewRecorder()
+			corsRouter(tc.origins).ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tc.want {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	downstreamTimeout = 5 * time.Second
+
+	defaultUpstreamRetries = 2
+	// maxUpstreamRetries is the most UPSTREAM_RETRIES LoadConfig accepts.
+	maxUpstreamRetries = 10
+	// retryBaseDelay is the backoff before the first retry; it doubles on
+	// each attempt after that, up to maxRetryDelay.
+	retryBaseDelay = 100 * time.Millisecond
+	maxRetryDelay  = 5 * time.Second
+)
+
+// downstreamClient calls the optional service behind UPSTREAM_URL so the
+// demo can show cancellation propagating through a chain of services.
+type downstreamClient struct {
+	url    string
+	client *http.Client
+	// transport is the client's own connection pool, so shutdown can
+	// close its idle keep-alive connections without touching
+	// http.DefaultTransport.
+	transport *http.Transport
+	// openConns counts the pool's open connections, idle or in use.
+	openConns atomic.Int64
+	// retries is how many extra attempts a failed fetch gets.
+	retries int
+	// timeout bounds a whole fetch, retries included, independently of
+	// the caller's deadline; 0 leaves only that deadline.
+	timeout time.Duration
+	breaker *circuitBreaker
+
+	// cacheTTL is how long the last successful body may stand in for a
+	// failed fetch; 0 disables the cache.
+	cacheTTL time.Duration
+	mu       sync.Mutex
+	lastBody any
+	lastAt   time.Time
+}
+
+func newDownstreamClient(url string, retries int, timeout, cacheTTL time.Duration) *downstreamClient {
+	d := &downstreamClient{
+		url:      url,
+		retries:  retries,
+		timeout:  timeout,
+		breaker:  newCircuitBreaker(breakerFailureThreshold, breakerCooldown),
+		cacheTTL: cacheTTL,
+	}
+	d.transport = http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	d.transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		d.openConns.Add(1)
+		return &countedConn{Conn: conn, open: &d.openConns}, nil
+	}
+	d.client = &http.Client{Timeout: downstreamTimeout, Transport: d.transport}
+	return d
+}
+
+// countedConn decrements open when it is first closed.
+type countedConn struct {
+	net.Conn
+	open *atomic.Int64
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.open.Add(-1) })
+	return c.Conn.Close()
+}
+
+// closeIdle closes the pool's idle keep-alive connections. It runs as a
+// shutdown hook, after the HTTP drain, so no request is still using the
+// pool and the downstream, which may be draining too, isn't sent more
+// work over a connection it is about to drop.
+func (d *downstreamClient) closeIdle(context.Context) error {
+	before := d.openConns.Load()
+	d.transport.CloseIdleConnections()
+	after := d.openConns.Load()
+	slog.Info("closed idle downstream connections", "event", "downstream_idle_closed", "closed", before-after, "still_open", after)
+	return nil
+}
+
+// cached returns the last successful body if it is younger than cacheTTL.
+func (d *downstreamClient) cached() (any, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cacheTTL <= 0 || d.lastAt.IsZero() || time.Since(d.lastAt) > d.cacheTTL {
+		return nil, false
+	}
+	return d.lastBody, true
+}
+
+// errUpstreamTimeout is returned by fetch when UPSTREAM_TIMEOUT ran out
+// before the caller's own deadline did.
+var errUpstreamTimeout = errors.New("downstream did not answer within UPSTREAM_TIMEOUT")
+
+// statusError is a non-2xx downstream response.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("downstream returned %d", e.code)
+}
+
+// retryable reports whether a failed attempt is worth repeating:
+// connection errors and 5xx are, 4xx means the request itself is wrong.
+func retryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500
+	}
+	return true
+}
+
+// backoff returns the delay before retry n (starting at 0): exponential
+// with full jitter so retries from many pods don't line up, capped at
+// maxRetryDelay. The shift is clamped so a large n can't overflow.
+func backoff(n int) time.Duration {
+	return time.Duration(rand.Int63n(int64(min(retryBaseDelay<<min(n, 16), maxRetryDelay))))
+}
+
+// ping reports whether the downstream is reachable, for the /health
+// check. Any response below 500 counts as up.
+func (d *downstreamClient) ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, d.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("downstream returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// fetch GETs the downstream URL through the circuit breaker. A fetch that
+// exhausts its retries or d.timeout counts as one failure; 4xx responses
+// mean the downstream is up and count as successes.
+func (d *downstreamClient) fetch(ctx context.Context) (any, error) {
+	if err := d.breaker.allow(); err != nil {
+		return nil, err
+	}
+	callCtx := ctx
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	body, err := d.fetchWithRetries(callCtx)
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up, which says nothing about the downstream
+		d.breaker.release()
+		return nil, err
+	}
+	if err != nil && callCtx.Err() != nil {
+		err = fmt.Errorf("%w (%s): %v", errUpstreamTimeout, d.timeout, err)
+	}
+	d.breaker.record(err != nil && retryable(err))
+	if err == nil && d.cacheTTL > 0 {
+		d.mu.Lock()
+		d.lastBody, d.lastAt = body, time.Now()
+		d.mu.Unlock()
+	}
+	return body, err
+}
+
+// fetchWithRetries retries transient failures up to d.retries times. ctx
+// bounds the whole sequence, so retries stop as soon as the caller's
+// deadline passes or the request is cancelled.
+func (d *downstreamClient) fetchWithRetries(ctx context.Context) (any, error) {
+	for attempt := 0; ; attempt++ {
+		body, err := d.fetchOnce(ctx)
+		if err == nil || attempt >= d.retries || !retryable(err) || ctx.Err() != nil {
+			return body, err
+		}
+		delay := backoff(attempt)
+		slog.Debug("retrying downstream call", "event", "downstream_retry", "attempt", attempt+1, "delay_ms", delay.Milliseconds(), "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+	}
+}
+
+// fetchOnce makes a single GET with ctx, so a cancelled request also
+// cancels the downstream call. JSON bodies are passed through as-is and
+// anything else is returned as a string. The trace context in ctx is
+// forwarded so the downstream's spans join the same trace.
+func (d *downstreamClient) fetchOnce(ctx context.Context) (any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	tracePropagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read downstream body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &statusError{code: resp.StatusCode}
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body), nil
+	}
+	return string(body), nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAPIDataIncludesDownstreamBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"hello":"world"}`))
+	}))
+	defer backend.Close()
+
+	cfg := defaultConfig()
+	cfg.UpstreamURL = backend.URL
+	r := newRouter(newApp(cfg))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/data", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var body struct {
+		Downstream map[string]string `json:"downstream"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Downstream["hello"] != "world" {
+		t.Errorf("downstream = %v, want hello=world", body.Downstream)
+	}
+}
+
+func TestAPIDataReturns502WhenDownstreamFails(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	cfg := defaultConfig()
+	cfg.UpstreamURL = backend.URL
+	r := newRouter(newApp(cfg))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/data", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", w.Code)
+	}
+}
+
+func TestAPIDataServesCachedResponseWhenDownstreamFails(t *testing.T) {
+	var failing atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"hello":"world"}`))
+	}))
+	defer backend.Close()
+
+	cfg := defaultConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	cfg.UpstreamURL = backend.URL
+	cfg.UpstreamRetries = 0
+	cfg.CacheTTL = time.Minute
+	r := newRouter(newApp(cfg))
+
+	if got := statusOf(r, "/api/data"); got != http.StatusOK {
+		t.Fatalf("priming request = %d, want 200", got)
+	}
+	failing.Store(true)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/data", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 from the cache", w.Code)
+	}
+	if got := w.Header().Get("X-Served-From-Cache"); got != "true" {
+		t.Errorf("X-Served-From-Cache = %q, want true", got)
+	}
+	var body struct {
+		Downstream map[string]string `json:"downstream"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Downstream["hello"] != "world" {
+		t.Errorf("downstream = %v, want the cached hello=world", body.Downstream)
+	}
+}
+
+func TestAPIDataRetriesFlakyDownstream(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer backend.Close()
+
+	cfg := defaultConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	cfg.UpstreamURL = backend.URL
+	r := newRouter(newApp(cfg))
+
+	if got := statusOf(r, "/api/data"); got != http.StatusOK {
+		t.Errorf("status = %d, want 200 after a retry", got)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("downstream calls = %d, want 2", n)
+	}
+}
+
+func TestDownstreamRetryPolicy(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		retries int
+		want    int32
+	}{
+		{"5xx retried until exhausted", http.StatusBadGateway, 2, 3},
+		{"4xx not retried", http.StatusNotFound, 2, 1},
+		{"retries disabled", http.StatusInternalServerError, 0, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(tc.status)
+			}))
+			defer backend.Close()
+
+			if _, err := newDownstreamClient(backend.URL, tc.retries, 0, 0).fetch(context.Background()); err == nil {
+				t.Fatal("fetch succeeded, want an error")
+			}
+			if n := calls.Load(); n != tc.want {
+				t.Errorf("downstream calls = %d, want %d", n, tc.want)
+			}
+		})
+	}
+}
+
+func TestBackoffStaysWithinMaxRetryDelay(t *testing.T) {
+	for _, n := range []int{0, 10, 63, 64, 1000} {
+		if d := backoff(n); d < 0 || d >= maxRetryDelay {
+			t.Errorf("backoff(%d) = %s, want within [0, %s)", n, d, maxRetryDelay)
+		}
+	}
+}
+
+func TestDownstreamRetriesStopAtDeadline(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := newDownstreamClient(backend.URL, 100, 0, 0).fetch(ctx); err == nil {
+		t.Fatal("fetch succeeded, want an error")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("retries ran for %s past a 20ms deadline", elapsed)
+	}
+}
+
+func TestShutdownClosesIdleDownstreamConnections(t *testing.T) {
+	logs := captureLogs(t)
+	var backendClosed atomic.Int64
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			backendClosed.Add(1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	cfg := shutdownTestConfig()
+	cfg.UpstreamURL = backend.URL
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	cfg.Addr = freeAddr(t)
+	a := newApp(cfg)
+	srv := newHTTPServer(cfg, newRouter(a))
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+cfg.Addr+"/health")
+
+	resp, err := http.Get("http://" + cfg.Addr + "/api/data")
+	if err != nil {
+		t.Fatalf("GET /api/data: %v", err)
+	}
+	resp.Body.Close()
+	open := a.downstream.openConns.Load()
+	if open < 1 {
+		t.Fatalf("downstream pool has %d open connections after a call, want a kept-alive one", open)
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+	if err := <-done; err != nil {
+		t.Fatalf("serveGraceful: %v", err)
+	}
+	if n := a.downstream.openConns.Load(); n != 0 {
+		t.Errorf("downstream pool has %d open connections after shutdown, want 0", n)
+	}
+	waitForConns(t, "downstream to see its connections close", func() bool { return backendClosed.Load() == open })
+	if want := fmt.Sprintf(`"closed":%d`, open); !strings.Contains(logs.String(), want) {
+		t.Errorf("logs missing downstream_idle_closed with %s:\n%s", want, logs.String())
+	}
+}
+
+func TestUpstreamTimeoutReturns504BeforeRequestDeadline(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer backend.Close()
+
+	cfg := defaultConfig()
+	cfg.UpstreamURL = backend.URL
+	cfg.UpstreamTimeout = 100 * time.Millisecond
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	r := newRouter(newApp(cfg))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/data", nil).WithContext(ctx))
+	elapsed := time.Since(start)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504: %s", w.Code, w.Body.String())
+	}
+	assertErrorEnvelope(t, w, codeTimeout)
+	if !strings.Contains(w.Body.String(), "UPSTREAM_TIMEOUT") {
+		t.Errorf("body = %s, want it to name UPSTREAM_TIMEOUT", w.Body.String())
+	}
+	if elapsed > time.Second {
+		t.Errorf("504 took %v, want about the 100ms UPSTREAM_TIMEOUT", elapsed)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("request context expired (%v); the downstream timeout should fire first", ctx.Err())
+	}
+}
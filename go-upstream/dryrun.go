@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// rehearsalPoll is how often a dry-run drain checks whether the requests
+// that were in flight at the signal have finished.
+const rehearsalPoll = 50 * time.Millisecond
+
+// rehearseShutdown is what a shutdown signal does under
+// DRY_RUN_SHUTDOWN: it logs each phase the real shutdown would run, then
+// watches the requests that were in flight at the signal and reports
+// whether they finished within SHUTDOWN_TIMEOUT. Nothing is changed, so
+// the server keeps serving throughout.
+func (a *app) rehearseShutdown() {
+	if !a.rehearsing.CompareAndSwap(false, true) {
+		slog.Info("dry run: rehearsal already running — signal ignored", "event", "shutdown_rehearsal_skipped")
+		return
+	}
+	start := time.Now()
+	pending := map[uint64]bool{}
+	a.active.Range(func(k, _ any) bool {
+		pending[k.(uint64)] = true
+		return true
+	})
+
+	rehearse := func(phase, msg string, args ...any) {
+		slog.Info("dry run: "+msg, append([]any{"event", "shutdown_rehearsal", "phase", phase}, args...)...)
+	}
+	rehearse("readiness", "would fail /ready")
+	rehearse("lame_duck", "would keep serving before rejecting new requests", "delay_ms", a.cfg.LameDuckDelay.Milliseconds())
+	rehearse("keep_alives", "would disable keep-alives")
+	rehearse("websockets", "would close websockets", "connections", a.websockets.Len())
+	rehearse("http_drain", "would wait for in-flight requests", "in_flight", len(pending), "timeout_ms", a.cfg.ShutdownTimeout.Milliseconds())
+
+	go func() {
+		defer a.rehearsing.Store(false)
+		deadline := start.Add(a.cfg.ShutdownTimeout)
+		ticker := time.NewTicker(rehearsalPoll)
+		defer ticker.Stop()
+		for {
+			for id := range pending {
+				if _, ok := a.active.Load(id); !ok {
+					delete(pending, id)
+				}
+			}
+			if len(pending) == 0 || !time.Now().Before(deadline) {
+				break
+			}
+			<-ticker.C
+		}
+		elapsed := time.Since(start)
+		slog.Info("dry run: shutdown rehearsal finished", "event", "shutdown_rehearsal_complete",
+			"would_finish", len(pending) == 0, "unfinished", len(pending), "elapsed_ms", elapsed.Milliseconds(),
+			"headroom_ms", (a.cfg.ShutdownTimeout - elapsed).Milliseconds())
+	}()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDryRunShutdownKeepsServing(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := shutdownTestConfig()
+	cfg.DryRunShutdown = true
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	cfg.Addr = freeAddr(t)
+	a := newApp(cfg)
+	r := newRouter(a)
+	started := make(chan struct{})
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	srv := newHTTPServer(cfg, r)
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	base := "http://" + cfg.Addr
+	waitForServer(t, base+"/health")
+
+	go http.Get(base + "/slow")
+	<-started
+	sendSignal(t, syscall.SIGTERM)
+	waitForLog(t, logs, "shutdown_rehearsal_complete")
+	if !strings.Contains(logs.String(), `"would_finish":true`) {
+		t.Errorf("rehearsal did not report the slow request finishing in time:\n%s", logs.String())
+	}
+
+	for _, path := range []string{"/ready", "/api/data"} {
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatalf("GET %s after dry-run SIGTERM: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s after dry-run SIGTERM = %d, want 200", path, resp.StatusCode)
+		}
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("serveGraceful returned during a dry run: %v", err)
+	default:
+	}
+
+	a.requestShutdown()
+	if err := <-done; err != nil {
+		t.Fatalf("serveGraceful: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import "github.com/gin-gonic/gin"
+
+// Error codes used in the error envelope. Clients should branch on these
+// rather than on the message, which is meant for humans.
+const (
+	codeNotFound           = "not_found"
+	codeMethodNotAllowed   = "method_not_allowed"
+	codeInvalidRequest     = "invalid_request"
+	codeUnauthorized       = "unauthorized"
+	codeBodyTooLarge       = "body_too_large"
+	codeRateLimited        = "rate_limited"
+	codeTimeout            = "timeout"
+	codeCancelled          = "request_cancelled"
+	codeShuttingDown       = "shutting_down"
+	codeOverCapacity       = "over_capacity"
+	codeInternal           = "internal"
+	codeSimulatedFailure   = "simulated_failure"
+	codeCircuitOpen        = "circuit_open"
+	codeDownstreamFailed   = "downstream_failed"
+	codeGracefulDisabled   = "graceful_disabled"
+	codeShutdownInProgress = "shutdown_in_progress"
+)
+
+// abortWithError ends the request with status and the standard error
+// envelope:
+//
+//	{"error":{"code":"...","message":"...","request_id":"..."}}
+//
+// Every handler and middleware reports errors through here so clients
+// only have to parse one shape.
+func abortWithError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": gin.H{
+		"code":       code,
+		"message":    message,
+		"request_id": c.GetString(requestIDKey),
+	}})
+}
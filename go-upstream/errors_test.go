@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// errorEnvelope is the decoded shape abortWithError writes.
+type errorEnvelope struct {
+	Error struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	} `json:"error"`
+}
+
+// assertErrorEnvelope checks that w holds the standard error envelope with
+// the given code and a request ID matching the response header.
+func assertErrorEnvelope(t *testing.T, w *httptest.ResponseRecorder, code string) {
+	t.Helper()
+	var env errorEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	if env.Error.Code != code {
+		t.Errorf("error.code = %q, want %q (body %s)", env.Error.Code, code, w.Body.String())
+	}
+	if env.Error.Message == "" {
+		t.Error("error.message is empty")
+	}
+	if id := w.Header().Get(requestIDHeader); env.Error.RequestID != id || id == "" {
+		t.Errorf("error.request_id = %q, want the %s header %q", env.Error.RequestID, requestIDHeader, id)
+	}
+}
+
+func TestRateLimitedRequestUsesErrorEnvelope(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	cfg.RateLimitRPS, cfg.RateLimitBurst = 1, 1
+	r := newRouter(newApp(cfg))
+
+	statusOf(r, "/api/data")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/data", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", w.Code)
+	}
+	assertErrorEnvelope(t, w, codeRateLimited)
+}
+
+func TestDrainRejectedRequestUsesErrorEnvelope(t *testing.T) {
+	a := newApp(defaultConfig())
+	r := newRouter(a)
+	a.shuttingDown.Store(true)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/data", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	assertErrorEnvelope(t, w, codeShuttingDown)
+}
+
+func TestUnknownRouteUsesErrorEnvelope(t *testing.T) {
+	r := newRouter(newApp(defaultConfig()))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+	assertErrorEnvelope(t, w, codeNotFound)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const eventsInterval = time.Second
+
+// streamingRoute reports whether path is a long-lived stream or
+// WebSocket. Streams are not counted as in flight: they end when the drain
+// does, so counting them would hold the drain open forever.
+func streamingRoute(path string) bool {
+	return path == "/events" || path == "/ws"
+}
+
+// handleEvents streams the lifecycle state and in-flight count as
+// Server-Sent Events every eventsInterval. Once shutdown starts it streams
+// the remaining drain budget, then sends a final drain_complete event and
+// returns so the connection closes as part of the graceful shutdown.
+func (a *app) handleEvents(c *gin.Context) {
+	// The stream is meant to outlive WRITE_TIMEOUT
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(eventsInterval)
+	defer ticker.Stop()
+
+	a.sendStateEvent(c)
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-a.drained:
+			_, since := a.lifecycle()
+			draining := time.Unix(0, a.lifecycleTimes.draining.Load())
+			c.SSEvent("drain_complete", gin.H{"state": stateShuttingDown, "elapsed_ms": since.Sub(draining).Milliseconds()})
+			c.Writer.Flush()
+			return
+		case <-ticker.C:
+			a.sendStateEvent(c)
+		}
+	}
+}
+
+// sendStateEvent writes one "state" event, or a "countdown" event with the
+// time left before SHUTDOWN_TIMEOUT once the drain has started.
+func (a *app) sendStateEvent(c *gin.Context) {
+	state, _ := a.lifecycle()
+	data := gin.H{"state": state, "in_flight": a.inFlight.Load()}
+	name := "state"
+	if state == stateDraining {
+		name = "countdown"
+		deadline := time.Unix(0, a.lifecycleTimes.draining.Load()).Add(a.cfg.ShutdownTimeout)
+		data["remaining_ms"] = max(time.Until(deadline).Milliseconds(), 0)
+	}
+	c.SSEvent(name, data)
+	c.Writer.Flush()
+}
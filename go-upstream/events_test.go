@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readEvent returns the name and data of the next SSE event on br.
+func readEvent(t *testing.T, br *bufio.Reader) (name, data string) {
+	t.Helper()
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v (got %q so far)", err, name)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if name != "" || data != "" {
+				return name, data
+			}
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimPrefix(line, "data:")
+		}
+	}
+}
+
+func TestEventsStreamsStateUntilDrainCompletes(t *testing.T) {
+	a := newApp(shutdownTestConfig())
+	a.startWarmup(0)
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: newRouter(a)}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+
+	resp, err := http.Get("http://" + addr + "/events")
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+	br := bufio.NewReader(resp.Body)
+
+	for i := 0; i < 2; i++ {
+		name, data := readEvent(t, br)
+		if name != "state" || !strings.Contains(data, `"state":"ready"`) {
+			t.Fatalf("event %d = %s %s, want a ready state event", i, name, data)
+		}
+	}
+
+	// The open stream must not count as in flight or hold up the drain
+	sendSignal(t, syscall.SIGTERM)
+	name, data := readEvent(t, br)
+	if name != "drain_complete" {
+		t.Fatalf("event after SIGTERM = %s %s, want drain_complete", name, data)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveGraceful: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown blocked by the open event stream")
+	}
+}
+
+func TestStateEventCountsDownDuringDrain(t *testing.T) {
+	a := newApp(defaultConfig())
+	markNow(&a.lifecycleTimes.draining)
+	a.shuttingDown.Store(true)
+	a.inFlight.Add(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	a.sendStateEvent(c)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "event:countdown") || !strings.Contains(body, `"remaining_ms":`) {
+		t.Errorf("event = %q, want a countdown with remaining_ms", body)
+	}
+}
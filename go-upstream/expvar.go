@@ -0,0 +1,24 @@
+package main
+
+import (
+	"expvar"
+	"time"
+)
+
+// Counters for tooling that reads /debug/vars instead of Prometheus. They
+// are updated next to their Prometheus counterparts. expvar has a single
+// global registry, so unlike the metrics these are shared by every app in
+// the process; in production there is only one.
+var (
+	processStart = time.Now()
+
+	varRequests  = expvar.NewInt("requests_total")
+	varInFlight  = expvar.NewInt("requests_in_flight")
+	varShutdowns = expvar.NewInt("shutdowns_initiated_total")
+)
+
+func init() {
+	expvar.Publish("uptime_seconds", expvar.Func(func() any {
+		return time.Since(processStart).Seconds()
+	}))
+}
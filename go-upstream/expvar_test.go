@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func readVars(t *testing.T, r http.Handler) map[string]any {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/debug/vars = %d, want 200", w.Code)
+	}
+	var vars map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("decode /debug/vars: %v", err)
+	}
+	return vars
+}
+
+func TestExpvarRequestCounterIncrements(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EnablePprof = true
+	r := newRouter(newApp(cfg))
+
+	before := readVars(t, r)
+	for _, key := range []string{"requests_total", "requests_in_flight", "shutdowns_initiated_total", "uptime_seconds"} {
+		if _, ok := before[key]; !ok {
+			t.Errorf("/debug/vars is missing %s", key)
+		}
+	}
+
+	statusOf(r, "/health")
+	after := readVars(t, r)
+	// The first /debug/vars read and the /health request both count
+	if got, want := after["requests_total"].(float64), before["requests_total"].(float64)+2; got != want {
+		t.Errorf("requests_total = %v, want %v", got, want)
+	}
+}
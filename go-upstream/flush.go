@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// flushTimeout bounds each flusher, so a wedged exporter delays exit by a
+// second at most.
+const flushTimeout = time.Second
+
+// Flusher holds output that would be lost on exit, such as a buffered log
+// writer or a push-based metrics exporter.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+type namedFlusher struct {
+	name string
+	f    Flusher
+}
+
+// RegisterFlusher adds f to the final flush step of shutdown. Register
+// before the server starts.
+func (a *app) RegisterFlusher(name string, f Flusher) {
+	a.flushers = append(a.flushers, namedFlusher{name, f})
+}
+
+// flush runs every flusher, each within flushTimeout. newApp registers it
+// as the first shutdown hook, so it runs last: after the HTTP drain and
+// every other hook, whose own final log lines it then writes out. It runs
+// even when the shutdown timeout has already run out, since unflushed
+// output is lost either way.
+func (a *app) flush(ctx context.Context) error {
+	ctx = context.WithoutCancel(ctx)
+	var errs []error
+	for _, nf := range a.flushers {
+		fctx, cancel := context.WithTimeout(ctx, flushTimeout)
+		err := nf.f.Flush(fctx)
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("flush %s: %w", nf.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fileFlusher syncs a log file to disk. Pipes and terminals have nothing
+// to sync and are skipped.
+type fileFlusher struct {
+	f *os.File
+}
+
+func (ff fileFlusher) Flush(context.Context) error {
+	info, err := ff.f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	return ff.f.Sync()
+}
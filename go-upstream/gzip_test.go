@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func echoRouter() *gin.Engine {
+	r := newRouter(newApp(defaultConfig()))
+	r.POST("/echo-test", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Data(http.StatusOK, "text/plain", body)
+	})
+	return r
+}
+
+func TestGzipCompressesLargeResponses(t *testing.T) {
+	r := echoRouter()
+	payload := strings.Repeat("graceful shutdown ", 200)
+
+	req := httptest.NewRequest(http.MethodPost, "/echo-test", strings.NewReader(payload))
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", got)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if string(got) != payload {
+		t.Errorf("decompressed body differs from the original (%d vs %d bytes)", len(got), len(payload))
+	}
+}
+
+func TestGzipSkipsSmallOrUnacceptedResponses(t *testing.T) {
+	r := echoRouter()
+
+	small := httptest.NewRequest(http.MethodPost, "/echo-test", strings.NewReader("tiny"))
+	small.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, small)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "tiny" {
+		t.Errorf("small body: encoding=%q body=%q, want it uncompressed", w.Header().Get("Content-Encoding"), w.Body.String())
+	}
+
+	large := strings.Repeat("x", 2048)
+	plain := httptest.NewRequest(http.MethodPost, "/echo-test", strings.NewReader(large))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, plain)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.Len() != len(large) {
+		t.Errorf("no Accept-Encoding: got encoding=%q, want uncompressed", w.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestGzipDoesNotDoubleCompress(t *testing.T) {
+	r := newRouter(newApp(defaultConfig()))
+	var pre bytes.Buffer
+	zw := gzip.NewWriter(&pre)
+	zw.Write([]byte(strings.Repeat("y", 2048)))
+	zw.Close()
+	r.GET("/encoded-test", func(c *gin.Context) {
+		c.Header("Content-Encoding", "gzip")
+		c.Data(http.StatusOK, "text/plain", pre.Bytes())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/encoded-test", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if !bytes.Equal(w.Body.Bytes(), pre.Bytes()) {
+		t.Error("already-encoded body was re-compressed")
+	}
+}
+
+func TestGzipBufferedBodyCountsAsWrittenForRouteTimeout(t *testing.T) {
+	r := newRouter(newApp(defaultConfig()))
+	payload := strings.Repeat("z", 2048)
+	r.GET("/late-test", routeTimeout(10*time.Millisecond), func(c *gin.Context) {
+		c.String(http.StatusOK, payload)
+		<-c.Request.Context().Done()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/late-test", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	got, _ := io.ReadAll(zr)
+	if string(got) != payload {
+		t.Errorf("body = %d bytes ending %q, want only the handler's %d bytes", len(got), got[max(len(got)-40, 0):], len(payload))
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	cases := map[string]bool{
+		"gzip":          true,
+		"deflate, gzip": true,
+		"GZIP;q=0.5":    true,
+		"gzip;q=0":      false,
+		"br":            false,
+		"":              false,
+	}
+	for header, want := range cases {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// configureHTTP2 sets srv up to serve HTTP/2 and returns the server that
+// handles those connections. Registering it with srv makes srv.Shutdown
+// send every HTTP/2 connection a GOAWAY: clients stop opening streams on
+// it and move to another pod, while streams already open run to
+// completion before the connection closes, instead of being reset.
+func configureHTTP2(srv *http.Server) *http2.Server {
+	h2s := &http2.Server{IdleTimeout: srv.IdleTimeout}
+	// Only fails on a TLS config with HTTP/2-incompatible cipher suites,
+	// which this server never sets
+	_ = http2.ConfigureServer(srv, h2s)
+	srv.RegisterOnShutdown(func() {
+		slog.Info("GOAWAY sent to HTTP/2 connections", "event", "http2_goaway_sent")
+	})
+	return h2s
+}
+
+// enableH2C lets srv accept HTTP/2 over cleartext, both with prior
+// knowledge and via the Upgrade header, alongside HTTP/1.1. h2c hands
+// those connections off via Hijack, so Shutdown only sends them GOAWAY
+// without waiting for their streams, and the drain phase waits on
+// in-flight requests instead.
+func enableH2C(srv *http.Server) {
+	srv.Handler = h2c.NewHandler(srv.Handler, configureHTTP2(srv))
+}
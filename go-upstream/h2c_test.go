@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2cClient speaks HTTP/2 with prior knowledge over plain TCP.
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+func TestH2CServesAndDrains(t *testing.T) {
+	cfg := shutdownTestConfig()
+	cfg.EnableH2C = true
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	cfg.Addr = freeAddr(t)
+	a := newApp(cfg)
+	r := newRouter(a)
+	started := make(chan struct{})
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	srv := newHTTPServer(cfg, r)
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+cfg.Addr+"/health")
+
+	client := h2cClient()
+	resp, err := client.Get("http://" + cfg.Addr + "/api/data")
+	if err != nil {
+		t.Fatalf("GET /api/data over h2c: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Fatalf("/api/data = %d over %s, want 200 over HTTP/2", resp.StatusCode, resp.Proto)
+	}
+
+	// A request in flight over h2c must finish before shutdown returns
+	slow := make(chan int, 1)
+	go func() {
+		resp, err := client.Get("http://" + cfg.Addr + "/slow")
+		if err != nil {
+			slow <- 0
+			return
+		}
+		resp.Body.Close()
+		slow <- resp.StatusCode
+	}()
+	<-started
+	sendSignal(t, syscall.SIGTERM)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveGraceful: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not complete with h2c enabled")
+	}
+	// The response has to be in by the time shutdown returns, or the
+	// process would have exited under it
+	select {
+	case code := <-slow:
+		if code != http.StatusOK {
+			t.Errorf("in-flight h2c request = %d, want 200", code)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Error("shutdown returned before the in-flight h2c request finished")
+	}
+}
+
+func TestH2CShutdownSendsGoAwayAndFinishesStreams(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := shutdownTestConfig()
+	cfg.EnableH2C = true
+	cfg.Addr = freeAddr(t)
+	a := newApp(cfg)
+	r := newRouter(a)
+	started := make(chan struct{})
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	srv := newHTTPServer(cfg, r)
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+cfg.Addr+"/health")
+
+	// Speak raw frames so the GOAWAY is visible, which http2.Transport hides
+	conn, err := net.Dial("tcp", cfg.Addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(http2.ClientPreface)); err != nil {
+		t.Fatalf("write preface: %v", err)
+	}
+	framer := http2.NewFramer(conn, conn)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	if err := framer.WriteSettings(); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	for _, f := range []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":authority", Value: cfg.Addr},
+		{Name: ":path", Value: "/slow"},
+	} {
+		enc.WriteField(f)
+	}
+	if err := framer.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: block.Bytes(), EndStream: true, EndHeaders: true}); err != nil {
+		t.Fatalf("write headers: %v", err)
+	}
+	<-started
+
+	sendSignal(t, syscall.SIGTERM)
+	var goAway *http2.GoAwayFrame
+	status := ""
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			// The server closes the connection once the stream is done
+			break
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				framer.WriteSettingsAck()
+			}
+		case *http2.GoAwayFrame:
+			if status != "" {
+				t.Error("GOAWAY arrived only after the in-flight stream finished")
+			}
+			if goAway == nil {
+				goAway = f
+			}
+		case *http2.MetaHeadersFrame:
+			if f.StreamID == 1 {
+				status = f.PseudoValue("status")
+			}
+		}
+	}
+
+	if goAway == nil {
+		t.Fatal("no GOAWAY received during shutdown")
+	}
+	if goAway.ErrCode != http2.ErrCodeNo || goAway.LastStreamID < 1 {
+		t.Errorf("GOAWAY = %v last stream %d, want NO_ERROR covering stream 1", goAway.ErrCode, goAway.LastStreamID)
+	}
+	if status != "200" {
+		t.Errorf("in-flight stream status = %q, want 200 after GOAWAY", status)
+	}
+	waitForLog(t, logs, "http2_goaway_sent")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveGraceful: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not complete")
+	}
+}
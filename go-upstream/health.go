@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultHealthCheckTimeout bounds each checker so one slow dependency
+// can't hang the probe past the kubelet's own timeout.
+const defaultHealthCheckTimeout = 2 * time.Second
+
+// defaultHealthCacheTTL lets a burst of probes from several kubelets and
+// load balancers share one round of dependency checks.
+const defaultHealthCacheTTL = time.Second
+
+// HealthChecks is the registry of named checkers /health runs on every
+// probe. All checks run concurrently and each gets Timeout.
+type HealthChecks struct {
+	// Timeout bounds each check; 0 uses defaultHealthCheckTimeout.
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	checks map[string]func(context.Context) error
+
+	// cacheMu guards the last result and is held while computing a new
+	// one, so concurrent probes share a single run instead of each
+	// hitting the dependencies.
+	cacheMu       sync.Mutex
+	cachedAt      time.Time
+	cachedResults map[string]string
+	cachedFailing []string
+}
+
+// Register adds a named check, replacing any existing one with that name.
+func (h *HealthChecks) Register(name string, check func(context.Context) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.checks == nil {
+		h.checks = map[string]func(context.Context) error{}
+	}
+	h.checks[name] = check
+}
+
+// Run executes every check and returns each one's status ("ok", the error
+// text, or "timeout") along with the sorted names of the checks that
+// failed. A check still running at its timeout is reported as failed
+// without waiting for it, so one that ignores its context can't block the
+// probe.
+func (h *HealthChecks) Run(ctx context.Context) (results map[string]string, failing []string) {
+	h.mu.Lock()
+	checks := make(map[string]func(context.Context) error, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	timeout := h.Timeout
+	h.mu.Unlock()
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results = make(map[string]string, len(checks))
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) error) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			// Buffered so a check that outlives its timeout can still finish
+			done := make(chan error, 1)
+			go func() { done <- check(ctx) }()
+			status := "ok"
+			select {
+			case err := <-done:
+				if errors.Is(err, context.DeadlineExceeded) {
+					status = "timeout"
+				} else if err != nil {
+					status = err.Error()
+				}
+			case <-ctx.Done():
+				status = "timeout"
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = status
+			if status != "ok" {
+				failing = append(failing, name)
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	sort.Strings(failing)
+	return results, failing
+}
+
+// RunCached returns the last result of Run if it is younger than ttl, and
+// runs the checks afresh otherwise. A ttl of 0 always runs them.
+func (h *HealthChecks) RunCached(ctx context.Context, ttl time.Duration) (results map[string]string, failing []string) {
+	if ttl <= 0 {
+		return h.Run(ctx)
+	}
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+	if h.cachedResults != nil && time.Since(h.cachedAt) < ttl {
+		return h.cachedResults, h.cachedFailing
+	}
+	results, failing = h.Run(ctx)
+	h.cachedAt, h.cachedResults, h.cachedFailing = time.Now(), results, failing
+	return results, failing
+}
+
+// HEALTH_FORMAT values.
+const (
+	healthFormatJSON = "json"
+	healthFormatText = "text"
+)
+
+// probeResponse writes a /health or /ready body. With HEALTH_FORMAT=text
+// it is a single plain line for checks that only match a substring: "OK"
+// on success, otherwise the status and, for /health, the failing checks.
+func (a *app) probeResponse(c *gin.Context, code int, body gin.H) {
+	if a.cfg.HealthFormat != healthFormatText {
+		c.JSON(code, body)
+		return
+	}
+	line := "OK"
+	if code != http.StatusOK {
+		line = fmt.Sprint(body["status"])
+		if failing, ok := body["failing"].([]string); ok {
+			line += ": " + strings.Join(failing, ", ")
+		}
+	}
+	c.String(code, line+"\n")
+}
+
+// validHealthStatus reports whether code can be forced as the /health
+// status.
+func validHealthStatus(code int) bool {
+	return code >= 200 && code <= 599
+}
+
+// heartbeatCheck fails once the heartbeat is older than staleness.
+func heartbeatCheck(h *heartbeat, staleness time.Duration) func(context.Context) error {
+	return func(context.Context) error {
+		if age := h.age(); age > staleness {
+			return fmt.Errorf("last heartbeat %dms ago", age.Milliseconds())
+		}
+		return nil
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type healthBody struct {
+	Status  string            `json:"status"`
+	Checks  map[string]string `json:"checks"`
+	Failing []string          `json:"failing"`
+}
+
+func getHealth(t *testing.T, r http.Handler) (int, healthBody) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var body healthBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	return w.Code, body
+}
+
+func TestHealthReportsFailingChecker(t *testing.T) {
+	a := newApp(defaultConfig())
+	a.health.Register("cache", func(context.Context) error { return nil })
+	a.health.Register("database", func(context.Context) error { return errors.New("connection refused") })
+
+	code, body := getHealth(t, newRouter(a))
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", code)
+	}
+	if len(body.Failing) != 1 || body.Failing[0] != "database" {
+		t.Errorf("failing = %v, want [database]", body.Failing)
+	}
+	if body.Checks["database"] != "connection refused" || body.Checks["cache"] != "ok" {
+		t.Errorf("checks = %v", body.Checks)
+	}
+}
+
+func TestHealthReportsCheckPastTimeout(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.HealthCheckTimeout = 50 * time.Millisecond
+	a := newApp(cfg)
+	// Ignores its context, so only the timeout can unblock the probe
+	release := make(chan struct{})
+	defer close(release)
+	a.health.Register("database", func(context.Context) error {
+		<-release
+		return nil
+	})
+
+	start := time.Now()
+	code, body := getHealth(t, newRouter(a))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("/health took %v with a hung check, want about the 50ms timeout", elapsed)
+	}
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", code)
+	}
+	if body.Checks["database"] != "timeout" || body.Checks["heartbeat"] != "ok" {
+		t.Errorf("checks = %v, want database timed out and heartbeat ok", body.Checks)
+	}
+}
+
+func TestHealthFormatSwitchesProbeBodies(t *testing.T) {
+	tests := []struct {
+		format, path, contentType, body string
+	}{
+		{"json", "/health", "application/json", `"status":"healthy"`},
+		{"json", "/ready", "application/json", `"status":"ready"`},
+		{"json", "/version", "application/json", `"version":"dev"`},
+		{"text", "/health", "text/plain", "OK\n"},
+		{"text", "/ready", "text/plain", "OK\n"},
+		{"text", "/version", "text/plain", "version=dev commit="},
+	}
+	for _, tt := range tests {
+		cfg := defaultConfig()
+		cfg.HealthFormat = tt.format
+		r := newRouter(newApp(cfg))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+			t.Errorf("%s %s Content-Type = %q, want %s", tt.format, tt.path, got, tt.contentType)
+		}
+		if !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("%s %s body = %q, want it to contain %q", tt.format, tt.path, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestTextHealthNamesFailingChecks(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.HealthFormat = "text"
+	a := newApp(cfg)
+	a.health.Register("database", func(context.Context) error { return errors.New("connection refused") })
+	a.shuttingDown.Store(true)
+	r := newRouter(a)
+
+	for path, want := range map[string]string{"/health": "unhealthy: database\n", "/ready": "shutting_down\n"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusServiceUnavailable || w.Body.String() != want {
+			t.Errorf("%s = %d %q, want 503 %q", path, w.Code, w.Body.String(), want)
+		}
+	}
+}
+
+func TestHealthPassesWithHealthyChecks(t *testing.T) {
+	code, body := getHealth(t, newRouter(newApp(defaultConfig())))
+	if code != http.StatusOK || body.Status != "healthy" {
+		t.Fatalf("/health = %d %+v, want 200 healthy", code, body)
+	}
+	if body.Checks["heartbeat"] != "ok" {
+		t.Errorf("heartbeat check = %q, want ok", body.Checks["heartbeat"])
+	}
+}
+
+func TestHealthChecksDownstream(t *testing.T) {
+	status := http.StatusOK
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer downstream.Close()
+
+	cfg := defaultConfig()
+	cfg.UpstreamURL = downstream.URL
+	cfg.HealthCacheTTL = 0
+	r := newRouter(newApp(cfg))
+
+	if code, body := getHealth(t, r); code != http.StatusOK || body.Checks["downstream"] != "ok" {
+		t.Errorf("healthy downstream: /health = %d %+v", code, body)
+	}
+
+	status = http.StatusServiceUnavailable
+	if code, body := getHealth(t, r); code != http.StatusServiceUnavailable || len(body.Failing) != 1 || body.Failing[0] != "downstream" {
+		t.Errorf("failing downstream: /health = %d %+v", code, body)
+	}
+}
+
+func TestHealthCacheRunsCheckOncePerTTL(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.HealthCacheTTL = time.Minute
+	a := newApp(cfg)
+	var runs atomic.Int64
+	a.health.Register("counted", func(context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	r := newRouter(a)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if code, _ := getHealth(t, r); code != http.StatusOK {
+				t.Errorf("/health = %d, want 200", code)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := runs.Load(); n != 1 {
+		t.Errorf("check ran %d times within the TTL, want 1", n)
+	}
+
+	// Shutdown bypasses the cache so drain-time probes see fresh state
+	a.shuttingDown.Store(true)
+	getHealth(t, r)
+	if n := runs.Load(); n != 2 {
+		t.Errorf("check ran %d times after shutdown started, want 2", n)
+	}
+}
+
+func TestProbeAliasesMatchOriginals(t *testing.T) {
+	a := newApp(defaultConfig())
+	r := newRouter(a)
+	check := func(phase string) {
+		t.Helper()
+		for alias, orig := range map[string]string{"/healthz": "/health", "/readyz": "/ready"} {
+			if got, want := statusOf(r, alias), statusOf(r, orig); got != want {
+				t.Errorf("%s: %s = %d, %s = %d", phase, alias, got, orig, want)
+			}
+		}
+	}
+	check("serving")
+	a.shuttingDown.Store(true)
+	if got := statusOf(r, "/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("/readyz during drain = %d, want 503", got)
+	}
+	check("draining")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const defaultHealthStaleness = 30 * time.Second
+
+// heartbeat records when a background goroutine last ran. If the process
+// wedges (deadlock, starved scheduler), the timestamp stops advancing and
+// /health starts failing so Kubernetes restarts the pod.
+type heartbeat struct {
+	last atomic.Int64 // unix nanoseconds
+}
+
+func (h *heartbeat) beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+// age is how long ago the last beat happened.
+func (h *heartbeat) age() time.Duration {
+	return time.Since(time.Unix(0, h.last.Load()))
+}
+
+// start beats every interval until the returned func is called. It is not
+// tied to the shutdown signal: liveness must keep passing while draining.
+func (h *heartbeat) start(interval time.Duration) (stop func()) {
+	h.beat()
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				h.beat()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// startHeartbeat beats often enough that a healthy process never comes
+// close to HEALTH_STALENESS. It is a no-op when the check is disabled.
+func (a *app) startHeartbeat() (stop func()) {
+	if a.cfg.HealthStaleness <= 0 {
+		return func() {}
+	}
+	return a.heartbeat.start(a.cfg.HealthStaleness / 3)
+}
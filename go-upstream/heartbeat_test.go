@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHealthFailsOnceHeartbeatIsStale(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.HealthStaleness = 60 * time.Millisecond
+	cfg.HealthCacheTTL = 0
+	a := newApp(cfg)
+	r := newRouter(a)
+
+	stop := a.startHeartbeat()
+	time.Sleep(2 * cfg.HealthStaleness)
+	if got := statusOf(r, "/health"); got != http.StatusOK {
+		t.Fatalf("/health with running heartbeat = %d, want 200", got)
+	}
+
+	stop()
+	time.Sleep(2 * cfg.HealthStaleness)
+	if got := statusOf(r, "/health"); got != http.StatusServiceUnavailable {
+		t.Errorf("/health with stopped heartbeat = %d, want 503", got)
+	}
+}
+
+func TestHealthStalenessCheckCanBeDisabled(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.HealthStaleness = 0
+	a := newApp(cfg)
+	a.heartbeat.last.Store(time.Now().Add(-time.Hour).UnixNano())
+
+	if got := statusOf(newRouter(a), "/health"); got != http.StatusOK {
+		t.Errorf("/health with check disabled = %d, want 200", got)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recentRequest is one finished request as GET /admin/requests reports it.
+type recentRequest struct {
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Time      time.Time `json:"time"`
+	LatencyMs int64     `json:"latency_ms"`
+	RequestID string    `json:"request_id"`
+}
+
+// requestHistory is a fixed-size ring of the most recently finished
+// requests, for looking back at the traffic a pod saw before a drain went
+// wrong. The zero value records nothing.
+type requestHistory struct {
+	mu      sync.Mutex
+	entries []recentRequest
+	// next is where the following entry goes once entries is full.
+	next int
+}
+
+func newRequestHistory(size int) *requestHistory {
+	return &requestHistory{entries: make([]recentRequest, 0, size)}
+}
+
+func (h *requestHistory) add(r recentRequest) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if cap(h.entries) == 0 {
+		return
+	}
+	if len(h.entries) < cap(h.entries) {
+		h.entries = append(h.entries, r)
+		return
+	}
+	h.entries[h.next] = r
+	h.next = (h.next + 1) % len(h.entries)
+}
+
+// recent returns the recorded requests, newest first.
+func (h *requestHistory) recent() []recentRequest {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]recentRequest, 0, len(h.entries))
+	// The newest entry is just before next, wrapping around
+	for i := 1; i <= len(h.entries); i++ {
+		out = append(out, h.entries[(h.next-i+len(h.entries))%len(h.entries)])
+	}
+	return out
+}
+
+// recordHistory adds every finished request except probes to h.
+func recordHistory(h *requestHistory) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		if probeRoute(c.FullPath()) {
+			return
+		}
+		h.add(recentRequest{
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Status:    c.Writer.Status(),
+			Time:      start,
+			LatencyMs: time.Since(start).Milliseconds(),
+			RequestID: c.GetString(requestIDKey),
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminRequestsReturnsNewestFirstUpToSize(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EnableAdmin = true
+	cfg.RequestLogSize = 3
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	r := newRouter(newApp(cfg))
+
+	for _, path := range []string{"/api/data", "/version", "/health", "/lifecycle", "/missing", "/stats"} {
+		statusOf(r, path)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/requests", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /admin/requests = %d, want 200", w.Code)
+	}
+	var body struct {
+		Size     int             `json:"size"`
+		Requests []recentRequest `json:"requests"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+
+	// /health is a probe and left out; the oldest requests fell off the ring
+	want := []struct {
+		path   string
+		status int
+	}{
+		{"/stats", http.StatusOK},
+		{"/missing", http.StatusNotFound},
+		{"/lifecycle", http.StatusOK},
+	}
+	if len(body.Requests) != len(want) {
+		t.Fatalf("got %d requests, want %d: %+v", len(body.Requests), len(want), body.Requests)
+	}
+	for i, w := range want {
+		got := body.Requests[i]
+		if got.Path != w.path || got.Status != w.status || got.Method != http.MethodGet || got.Time.IsZero() {
+			t.Errorf("requests[%d] = %+v, want GET %s %d", i, got, w.path, w.status)
+		}
+	}
+	if body.Requests[0].Time.Before(body.Requests[2].Time) {
+		t.Errorf("requests are not newest first: %+v", body.Requests)
+	}
+}
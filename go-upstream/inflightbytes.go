@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitInflightBytes sheds new requests with 503 while the request and
+// response bytes of the requests already being served add up to max or
+// more, modelling a pod that backs off under memory pressure. Bytes are
+// counted as bodies are read and responses written, and released when
+// each request ends. Streams never end, so they are not counted. max <= 0
+// disables the limit.
+func limitInflightBytes(max int, current *atomic.Int64) gin.HandlerFunc {
+	if max <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) {
+		if operationalRoute(c.FullPath()) || streamingRoute(c.FullPath()) {
+			c.Next()
+			return
+		}
+		if n := current.Load(); n >= int64(max) {
+			requestLog(c).Warn("in-flight bytes over the limit, shedding request", "event", "request_shed", "reason", "inflight_bytes", "inflight_bytes", n, "max_inflight_bytes", max)
+			abortWithError(c, http.StatusServiceUnavailable, codeOverCapacity, "server at capacity, retry later")
+			return
+		}
+
+		w := &countingWriter{ResponseWriter: c.Writer, current: current}
+		c.Writer = w
+		var body *countingBody
+		if c.Request.Body != nil {
+			body = &countingBody{ReadCloser: c.Request.Body, current: current}
+			c.Request.Body = body
+		}
+		defer func() {
+			n := w.n.Load()
+			if body != nil {
+				n += body.n.Load()
+			}
+			current.Add(-n)
+		}()
+		c.Next()
+	}
+}
+
+// countingBody adds every byte read from the request body to current.
+type countingBody struct {
+	io.ReadCloser
+	current *atomic.Int64
+	n       atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	b.current.Add(int64(n))
+	return n, err
+}
+
+// countingWriter adds every response byte written to current.
+type countingWriter struct {
+	gin.ResponseWriter
+	current *atomic.Int64
+	n       atomic.Int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.n.Add(int64(n))
+	w.current.Add(int64(n))
+	return n, err
+}
+
+func (w *countingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// memoryPressure reports whether in-flight bytes are at MAX_INFLIGHT_BYTES,
+// so /ready can steer traffic away while new requests are being shed.
+func (a *app) memoryPressure() bool {
+	return a.cfg.MaxInflightBytes > 0 && a.inflightBytes.Load() >= int64(a.cfg.MaxInflightBytes)
+}
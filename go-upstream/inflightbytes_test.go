@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMaxInflightBytesShedsUntilBytesFree(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MaxInflightBytes = 1000
+	a := newApp(cfg)
+	r := newRouter(a)
+
+	release := make(chan struct{})
+	read := make(chan struct{}, 2)
+	r.POST("/upload", func(c *gin.Context) {
+		io.ReadAll(c.Request.Body)
+		read <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	})
+	post := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("x", 600))))
+		return w.Code
+	}
+
+	// Each upload is under the limit on its own; together they are over it
+	held := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() { held <- post() }()
+		<-read
+	}
+	if n := a.inflightBytes.Load(); n != 1200 {
+		t.Fatalf("in-flight bytes = %d, want 1200", n)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/data", nil))
+	assertErrorEnvelope(t, w, codeOverCapacity)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("request past MAX_INFLIGHT_BYTES = %d, want 503", w.Code)
+	}
+	if got := statusOf(r, "/ready"); got != http.StatusServiceUnavailable {
+		t.Errorf("/ready under memory pressure = %d, want 503", got)
+	}
+	if got := statusOf(r, "/health"); got != http.StatusOK {
+		t.Errorf("/health under memory pressure = %d, want 200", got)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-held; code != http.StatusOK {
+			t.Errorf("held upload = %d, want 200", code)
+		}
+	}
+	if n := a.inflightBytes.Load(); n != 0 {
+		t.Errorf("in-flight bytes after the uploads finished = %d, want 0", n)
+	}
+	if got := statusOf(r, "/ready"); got != http.StatusOK {
+		t.Errorf("/ready once bytes freed = %d, want 200", got)
+	}
+}
+
+func TestMaxInflightBytesIgnoresStreams(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MaxInflightBytes = 10
+	a := newApp(cfg)
+	r := newRouter(a)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	// The first state event alone is past the limit
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	defer resp.Body.Close()
+	if name, _ := readEvent(t, bufio.NewReader(resp.Body)); name != "state" {
+		t.Fatalf("first event = %q, want state", name)
+	}
+
+	if n := a.inflightBytes.Load(); n != 0 {
+		t.Errorf("in-flight bytes with only a stream open = %d, want 0", n)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/data", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("/api/data while streaming = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const backgroundJobInterval = 5 * time.Second
+
+// startBackgroundJob runs work every interval on its own goroutine until
+// shutdown. Its stop hook cancels the job's context and waits for the
+// iteration in progress to finish, so non-HTTP work drains like requests do.
+func (a *app) startBackgroundJob(name string, interval time.Duration, work func(context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runTicker(ctx, interval, work)
+		slog.Info("background job stopped", "event", "job_stopped", "job", name)
+	}()
+
+	a.shutdown.Register(func(shutdownCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-shutdownCtx.Done():
+			return shutdownCtx.Err()
+		}
+	})
+}
+
+// runTicker calls work on every tick until ctx is cancelled. Cancellation
+// is only checked between iterations, so a running one is never cut short.
+func runTicker(ctx context.Context, interval time.Duration, work func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			work(ctx)
+		}
+	}
+}
+
+// logHeartbeatJob is the demo background job: it logs the in-flight
+// count on every tick.
+func (a *app) logHeartbeatJob(context.Context) {
+	slog.Info("background job tick", "event", "job_tick", "job", "heartbeat_logger", "in_flight", a.inFlight.Load())
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackgroundJobStopsOnShutdown(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	a := newApp(defaultConfig())
+	var ticks atomic.Int32
+	a.startBackgroundJob("test", interval, func(context.Context) { ticks.Add(1) })
+
+	deadline := time.Now().Add(time.Second)
+	for ticks.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(interval / 2)
+	}
+	if ticks.Load() < 2 {
+		t.Fatalf("job ticked %d times, want at least 2", ticks.Load())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	defer cancel()
+	if err := a.shutdown.RunShutdown(ctx); err != nil {
+		t.Fatalf("job did not stop within one interval: %v", err)
+	}
+	stopped := ticks.Load()
+	time.Sleep(3 * interval)
+	if n := ticks.Load(); n != stopped {
+		t.Errorf("job ticked %d more times after shutdown", n-stopped)
+	}
+}
+
+func TestBackgroundJobFinishesIterationInProgress(t *testing.T) {
+	a := newApp(defaultConfig())
+	started := make(chan struct{}, 1)
+	var finished atomic.Bool
+	a.startBackgroundJob("test", time.Millisecond, func(context.Context) {
+		select {
+		case started <- struct{}{}:
+		default:
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(true)
+	})
+	<-started
+
+	if err := a.shutdown.RunShutdown(context.Background()); err != nil {
+		t.Fatalf("RunShutdown: %v", err)
+	}
+	if !finished.Load() {
+		t.Error("shutdown returned before the running iteration finished")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Lifecycle states reported by /lifecycle, in the order a pod moves
+// through them.
+const (
+	stateStarting     = "starting"
+	stateReady        = "ready"
+	stateDraining     = "draining"
+	stateShuttingDown = "shutting_down"
+)
+
+// lifecycleTimes records when each transition happened, as unix
+// nanoseconds. The state itself is derived from the app's flags.
+type lifecycleTimes struct {
+	ready, draining, drained atomic.Int64
+}
+
+func markNow(t *atomic.Int64) {
+	t.Store(time.Now().UnixNano())
+}
+
+// lifecycle reports the current state and when it was entered. Draining
+// lasts while requests are in flight; once they finish the remaining
+// shutdown hooks run as shutting_down.
+func (a *app) lifecycle() (state string, since time.Time) {
+	at := func(t *atomic.Int64) time.Time { return time.Unix(0, t.Load()) }
+	select {
+	case <-a.drained:
+		return stateShuttingDown, at(&a.lifecycleTimes.drained)
+	default:
+	}
+	if a.shuttingDown.Load() {
+		return stateDraining, at(&a.lifecycleTimes.draining)
+	}
+	if a.started.Load() {
+		return stateReady, at(&a.lifecycleTimes.ready)
+	}
+	return stateStarting, processStart
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type lifecycleBody struct {
+	State    string    `json:"state"`
+	Since    time.Time `json:"since"`
+	InFlight int64     `json:"in_flight"`
+}
+
+func getLifecycle(t *testing.T, r http.Handler) lifecycleBody {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/lifecycle", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/lifecycle = %d, want 200", w.Code)
+	}
+	var body lifecycleBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+func TestLifecycleTransitions(t *testing.T) {
+	a := newApp(shutdownTestConfig())
+	r := newRouter(a)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	if got := getLifecycle(t, r); got.State != stateStarting {
+		t.Fatalf("state before warmup = %q, want %q", got.State, stateStarting)
+	}
+	a.startWarmup(0)
+	ready := getLifecycle(t, r)
+	if ready.State != stateReady || ready.InFlight != 0 {
+		t.Fatalf("after warmup = %+v, want ready with nothing in flight", ready)
+	}
+
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: r}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+	go func() {
+		if resp, err := http.Get("http://" + addr + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	sendSignal(t, syscall.SIGTERM)
+	deadline := time.Now().Add(2 * time.Second)
+	for !a.shuttingDown.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	draining := getLifecycle(t, r)
+	if draining.State != stateDraining || draining.InFlight != 1 {
+		t.Errorf("during drain = %+v, want draining with 1 in flight", draining)
+	}
+	if !draining.Since.After(ready.Since) {
+		t.Errorf("draining since %s, want after ready since %s", draining.Since, ready.Since)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("serveGraceful: %v", err)
+	}
+	if got := getLifecycle(t, r); got.State != stateShuttingDown {
+		t.Errorf("after drain = %q, want %q", got.State, stateShuttingDown)
+	}
+}
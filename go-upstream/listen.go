@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+)
+
+// listen opens the listener srv serves on: a Unix socket at LISTEN_SOCKET
+// when set, otherwise TCP on srv.Addr, capped at MAX_CONNS connections. A
+// stale socket left behind by a process that was SIGKILLed is unlinked
+// first so the bind succeeds.
+func (a *app) listen(srv *http.Server) (net.Listener, error) {
+	l, err := a.bind(srv)
+	if err != nil {
+		return nil, err
+	}
+	return limitConns(l, a.cfg.MaxConns), nil
+}
+
+func (a *app) bind(srv *http.Server) (net.Listener, error) {
+	path := a.cfg.ListenSocket
+	if path == "" {
+		var lc net.ListenConfig
+		if a.cfg.ReusePort {
+			if reusePortSupported {
+				lc.Control = reusePortControl
+			} else {
+				slog.Warn("SO_REUSEPORT is not supported on this platform — binding without it", "event", "reuse_port_unsupported")
+			}
+		}
+		return lc.Listen(context.Background(), "tcp", srv.Addr)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	// net.UnixListener unlinks the socket file when Shutdown closes it
+	return net.Listen("unix", path)
+}
+
+// serve runs srv on l, over TLS when a certificate is configured.
+func (a *app) serve(srv *http.Server, l net.Listener) error {
+	if a.cfg.TLSCertFile != "" {
+		return srv.ServeTLS(l, a.cfg.TLSCertFile, a.cfg.TLSKeyFile)
+	}
+	return srv.Serve(l)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// unixClient returns a client that sends every request to the socket at path.
+func unixClient(path string) *http.Client {
+	return &http.Client{
+		Timeout: 2 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+func TestServeGracefulOnUnixSocket(t *testing.T) {
+	// Socket paths are limited to ~100 bytes, too short for t.TempDir()
+	dir, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	// A leftover file from a killed process must not block the bind
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := shutdownTestConfig()
+	cfg.ListenSocket = path
+	a := newApp(cfg)
+	srv := newHTTPServer(cfg, newRouter(a))
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+
+	client := unixClient(path)
+	var resp *http.Response
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if resp, err = client.Get("http://unix/health"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET over unix socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/health = %d, want 200", resp.StatusCode)
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+	if err := <-done; err != nil {
+		t.Fatalf("serveGraceful: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("socket file still present after shutdown: %v", err)
+	}
+}
+
+func TestHostBindsConfiguredInterface(t *testing.T) {
+	logs := captureLogs(t)
+	_, port, _ := net.SplitHostPort(freeAddr(t))
+	t.Setenv("HOST", "127.0.0.1")
+	t.Setenv("PORT", port)
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if want := "127.0.0.1:" + port; cfg.Addr != want {
+		t.Fatalf("Addr = %q, want %q", cfg.Addr, want)
+	}
+	cfg.Graceful, cfg.LameDuckDelay = true, 0
+	a := newApp(cfg)
+	srv := newHTTPServer(cfg, newRouter(a))
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://127.0.0.1:"+port+"/health")
+
+	var bound string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		var e struct{ Event, Addr string }
+		if json.Unmarshal([]byte(line), &e) == nil && e.Event == "listening" {
+			bound = e.Addr
+		}
+	}
+	if bound != cfg.Addr {
+		t.Errorf("listening on %q, want %q", bound, cfg.Addr)
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+	if err := <-done; err != nil {
+		t.Fatalf("serveGraceful: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// loadgenOptions configures -mode=loadgen.
+type loadgenOptions struct {
+	URL         string
+	Duration    time.Duration
+	Concurrency int
+}
+
+func (o *loadgenOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.URL, "url", "http://localhost:7000/api/data", "loadgen: URL to request")
+	fs.DurationVar(&o.Duration, "duration", 30*time.Second, "loadgen: how long to generate load")
+	fs.IntVar(&o.Concurrency, "concurrency", 10, "loadgen: number of concurrent workers")
+}
+
+// loadResult summarizes a load run.
+type loadResult struct {
+	Successes int
+	Failures  int
+	// Statuses counts responses by status code; transport errors are keyed 0.
+	Statuses  map[int]int
+	Latencies []time.Duration
+}
+
+// runLoad sends GET requests to url from concurrency workers until ctx is
+// done or duration elapses. Any 2xx counts as a success.
+func runLoad(ctx context.Context, client *http.Client, url string, concurrency int, duration time.Duration) loadResult {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var (
+		mu  sync.Mutex
+		res = loadResult{Statuses: map[int]int{}}
+		wg  sync.WaitGroup
+	)
+	record := func(status int, latency time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		res.Statuses[status]++
+		res.Latencies = append(res.Latencies, latency)
+		if status >= 200 && status <= 299 {
+			res.Successes++
+		} else {
+			res.Failures++
+		}
+	}
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				start := time.Now()
+				status, err := doRequest(ctx, client, url)
+				if err != nil && ctx.Err() != nil {
+					// Cut off by the end of the run, not a server failure.
+					return
+				}
+				record(status, time.Since(start))
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(res.Latencies, func(i, j int) bool { return res.Latencies[i] < res.Latencies[j] })
+	return res
+}
+
+func doRequest(ctx context.Context, client *http.Client, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// percentile returns the p-th percentile (0-100) of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p / 100 * float64(len(sorted)-1))
+	return sorted[i]
+}
+
+func (r loadResult) print(w io.Writer) {
+	fmt.Fprintln(w, "========== LOADGEN SUMMARY ==========")
+	fmt.Fprintf(w, "Total requests: %d\n", r.Successes+r.Failures)
+	fmt.Fprintf(w, "Successes:      %d\n", r.Successes)
+	fmt.Fprintf(w, "Failures:       %d\n", r.Failures)
+	codes := make([]int, 0, len(r.Statuses))
+	for code := range r.Statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "error"
+		}
+		fmt.Fprintf(w, "  %-5s         %d\n", label, r.Statuses[code])
+	}
+	fmt.Fprintf(w, "Latency p50:    %s\n", percentile(r.Latencies, 50))
+	fmt.Fprintf(w, "Latency p95:    %s\n", percentile(r.Latencies, 95))
+	fmt.Fprintf(w, "Latency p99:    %s\n", percentile(r.Latencies, 99))
+	fmt.Fprintln(w, "=====================================")
+}
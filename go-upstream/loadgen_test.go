@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunLoadCountsSuccessesAndFailures(t *testing.T) {
+	var n atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every third request is shed, like a draining pod would.
+		if n.Add(1)%3 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	res := runLoad(context.Background(), srv.Client(), srv.URL, 4, 200*time.Millisecond)
+
+	if res.Successes == 0 || res.Failures == 0 {
+		t.Fatalf("successes=%d failures=%d, want both non-zero", res.Successes, res.Failures)
+	}
+	if res.Statuses[http.StatusServiceUnavailable] != res.Failures {
+		t.Errorf("503s = %d, failures = %d; want equal", res.Statuses[http.StatusServiceUnavailable], res.Failures)
+	}
+	if len(res.Latencies) != res.Successes+res.Failures {
+		t.Errorf("recorded %d latencies for %d requests", len(res.Latencies), res.Successes+res.Failures)
+	}
+
+	var out strings.Builder
+	res.print(&out)
+	for _, want := range []string{"Successes:", "Failures:", "p50", "p95", "p99"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("summary missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	if got := percentile(sorted, 50); got != 50*time.Millisecond {
+		t.Errorf("p50 = %s, want 50ms", got)
+	}
+	if got := percentile(sorted, 99); got != 99*time.Millisecond {
+		t.Errorf("p99 = %s, want 99ms", got)
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("p50 of empty = %s, want 0", got)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseLogLevel maps a LOG_LEVEL value (debug, info, warn, error) to a
+// slog level. Empty means info; unknown values report ok=false.
+func parseLogLevel(level string) (lvl slog.Level, ok bool) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "", "info":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+	return slog.LevelInfo, false
+}
+
+// newLogger returns a JSON slog logger writing to w at level.
+func newLogger(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// fatal logs msg at error level and exits with status 1.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// slogWriter adapts gin's DefaultWriter/DefaultErrorWriter output, and
+// net/http's server error log, to slog so neither writes plain lines
+// outside the JSON stream. Lines are tagged with event.
+type slogWriter struct {
+	level slog.Level
+	event string
+}
+
+func (w slogWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+		if len(line) > 0 {
+			slog.Log(context.Background(), w.level, string(line), "event", w.event)
+		}
+	}
+	return len(p), nil
+}
+
+// requestLog returns the default logger tagged with the request's ID so
+// every line logged while serving it can be correlated.
+func requestLog(c *gin.Context) *slog.Logger {
+	return slog.Default().With("request_id", c.GetString(requestIDKey))
+}
+
+// requestLogger replaces gin's text access log with one structured line per
+// request. Probes are left out unless logProbes is set.
+func requestLogger(logProbes bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if !logProbes && probeRoute(c.FullPath()) {
+			return
+		}
+		requestLog(c).Info("request",
+			"event", "request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"latency_ms", time.Since(start).Milliseconds(),
+			"bytes", max(c.Writer.Size(), 0),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+// probeRoute reports whether path is a kubelet probe, which would flood
+// the access log at one line per probe period.
+func probeRoute(path string) bool {
+	switch path {
+	case "/health", "/healthz", "/ready", "/readyz", "/startup":
+		return true
+	}
+	return false
+}
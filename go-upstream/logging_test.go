@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe to write from the dump goroutine while
+// the test reads it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs routes the default logger into a buffer for the rest of the test.
+func captureLogs(t *testing.T) *lockedBuffer {
+	t.Helper()
+	var buf lockedBuffer
+	prev := slog.Default()
+	slog.SetDefault(newLogger(&buf, slog.LevelDebug))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+// waitForLog polls buf until it contains an entry with the given event.
+func waitForLog(t *testing.T, buf *lockedBuffer, event string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if strings.Contains(buf.String(), `"event":"`+event+`"`) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no %s event logged:\n%s", event, buf.String())
+}
+
+func TestParseLogLevel(t *testing.T) {
+	cases := []struct {
+		in   string
+		want slog.Level
+		ok   bool
+	}{
+		{"", slog.LevelInfo, true},
+		{"debug", slog.LevelDebug, true},
+		{"WARN", slog.LevelWarn, true},
+		{"error", slog.LevelError, true},
+		{"bogus", slog.LevelInfo, false},
+	}
+	for _, tc := range cases {
+		got, ok := parseLogLevel(tc.in)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("parseLogLevel(%q) = %v, %v; want %v, %v", tc.in, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestNewLoggerRespectsLevel(t *testing.T) {
+	logger := newLogger(&bytes.Buffer{}, slog.LevelWarn)
+	if logger.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("info enabled on a warn logger")
+	}
+	if !logger.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("warn disabled on a warn logger")
+	}
+}
+
+func TestNewLoggerWritesJSON(t *testing.T) {
+	var buf bytes.Buffer
+	newLogger(&buf, slog.LevelInfo).Info("received signal", "event", "signal_received", "signal", "terminated")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v (%s)", err, buf.String())
+	}
+	if entry["event"] != "signal_received" || entry["signal"] != "terminated" {
+		t.Errorf("unexpected fields: %v", entry)
+	}
+}
+
+// accessLogEntries returns the decoded request log lines in buf.
+func accessLogEntries(t *testing.T, buf *lockedBuffer) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if !strings.Contains(line, `"event":"request"`) {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("decode %s: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAccessLogFields(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := defaultConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	r := newRouter(newApp(cfg))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+	req.Header.Set(requestIDHeader, "req-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	entries := accessLogEntries(t, logs)
+	if len(entries) != 1 {
+		t.Fatalf("got %d access log entries, want 1", len(entries))
+	}
+	e := entries[0]
+	for key, want := range map[string]any{
+		"method":     "GET",
+		"path":       "/api/data",
+		"status":     float64(200),
+		"request_id": "req-123",
+		"client_ip":  "192.0.2.1",
+		"bytes":      float64(w.Body.Len()),
+	} {
+		if e[key] != want {
+			t.Errorf("%s = %v, want %v", key, e[key], want)
+		}
+	}
+	if _, ok := e["latency_ms"].(float64); !ok {
+		t.Errorf("latency_ms missing: %v", e)
+	}
+}
+
+func TestAccessLogSkipsProbesByDefault(t *testing.T) {
+	for _, logProbes := range []bool{false, true} {
+		logs := captureLogs(t)
+		cfg := defaultConfig()
+		cfg.LogProbes = logProbes
+		r := newRouter(newApp(cfg))
+		statusOf(r, "/health")
+		statusOf(r, "/ready")
+
+		want := 0
+		if logProbes {
+			want = 2
+		}
+		if got := len(accessLogEntries(t, logs)); got != want {
+			t.Errorf("LogProbes=%v: got %d probe log entries, want %d", logProbes, got, want)
+		}
+	}
+}
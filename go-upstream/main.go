@@ -2,81 +2,724 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
+	"flag"
 	"fmt"
+	"io"
 	"log"
-	"math/rand"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
-func main() {
-	r := gin.Default()
-
-	r.GET("/api/data", func(c *gin.Context) {
-		// Simulate work with 100-200ms random sleep
-		sleepMs := 100 + rand.Intn(101)
-		time.Sleep(time.Duration(sleepMs) * time.Millisecond)
-
-		c.JSON(http.StatusOK, gin.H{
-			"source":     "go-upstream",
-			"message":    "Hello from Go upstream service",
-			"latency_ms": sleepMs,
-			"timestamp":  time.Now().Format(time.RFC3339),
-		})
+// statusClientClosedRequest is nginx's non-standard code for a client that
+// disconnected before the response was written.
+const statusClientClosedRequest = 499
+
+// app holds the state shared between the HTTP handlers and the shutdown path.
+type app struct {
+	// graceful chooses what a shutdown signal does: drain (true) or exit
+	// at once. It starts from GRACEFUL and can be flipped via the admin API.
+	graceful atomic.Bool
+	// exit ends the process on the non-graceful path; tests replace it.
+	exit func(code int)
+
+	// shuttingDown flips to true as soon as a shutdown signal arrives, so
+	// /ready fails while in-flight requests are still draining.
+	shuttingDown atomic.Bool
+	// lameDuck is set for the LAMEDUCK_DELAY window after readiness fails,
+	// while new requests are still served normally.
+	lameDuck atomic.Bool
+	// readyOverloaded latches while in-flight load is between the
+	// READY_MAX_INFLIGHT and READY_RESUME_INFLIGHT watermarks.
+	readyOverloaded atomic.Bool
+	// queued counts requests waiting for a MAX_CONCURRENT slot.
+	queued atomic.Int64
+	// inflightBytes is the request and response bytes of the requests
+	// being served, checked against MAX_INFLIGHT_BYTES.
+	inflightBytes atomic.Int64
+
+	// shutdownRequested is closed by /admin/shutdown to start the same
+	// drain as SIGTERM; shutdownTriggered guards against closing it twice.
+	shutdownRequested chan struct{}
+	shutdownTriggered atomic.Bool
+
+	// started flips to true once WARMUP_DELAY has elapsed, for /startup.
+	started atomic.Bool
+
+	// warmups run at startup; warming stays true until they all succeed,
+	// keeping /ready failing meanwhile.
+	warmups []func(context.Context) error
+	warming atomic.Bool
+
+	// lifecycleTimes records when the flags above flipped, for /lifecycle.
+	lifecycleTimes lifecycleTimes
+
+	// inFlight is the number of requests currently being served.
+	inFlight atomic.Int64
+
+	// active tracks each in-flight request by sequence number, so a drain
+	// that times out can report what was still running.
+	active     sync.Map // uint64 -> activeRequest
+	requestSeq atomic.Uint64
+
+	// drained is closed once inFlight reaches zero after shutdown starts.
+	drained     chan struct{}
+	drainedOnce sync.Once
+	// drainBegun is closed when the lame-duck window ends, releasing
+	// long polls that would otherwise hold the drain open.
+	drainBegun chan struct{}
+
+	// polls wakes waiting GET /poll requests.
+	polls pollHub
+	// history keeps the last REQUEST_LOG_SIZE finished requests for
+	// GET /admin/requests.
+	history *requestHistory
+
+	// heartbeat backs the /health staleness check.
+	heartbeat heartbeat
+
+	// health holds the checks /health runs.
+	health HealthChecks
+	// removalWaiter confirms endpoint removal for /prestop; nil means
+	// sleep PRESTOP_DELAY instead.
+	removalWaiter EndpointRemovalWaiter
+	// webhook announces the drain to SHUTDOWN_WEBHOOK_URL; nil when unset.
+	webhook *shutdownWebhook
+	// listenerCheck is the latest result of dialing our own listener.
+	listenerCheck listenerCheck
+	// websockets holds the open /ws connections so shutdown can close them.
+	websockets wsRegistry
+	// rehearsing is set while a DRY_RUN_SHUTDOWN rehearsal is watching the
+	// drain.
+	rehearsing atomic.Bool
+
+	// rand drives the simulated latency and ERROR_RATE, seeded per process.
+	rand *randSource
+
+	// forcedHealthStatus overrides the /health status code when non-zero,
+	// set from INITIAL_HEALTH_STATUS or /admin/health-status.
+	forcedHealthStatus atomic.Int64
+	// conns counts connections by state, fed by srv.ConnState.
+	conns connTracker
+
+	cfg Config
+	// extraFields is the decoded EXTRA_FIELDS object.
+	extraFields map[string]any
+	// filler pads /api/data to PAYLOAD_BYTES; built once so every response
+	// doesn't allocate it again.
+	filler string
+
+	// downstream is the optional service /api/data calls; nil when
+	// UPSTREAM_URL is unset.
+	downstream *downstreamClient
+
+	metrics *metrics
+
+	// tracerProvider creates the per-request spans; a no-op unless
+	// OTEL_EXPORTER_OTLP_ENDPOINT is set.
+	tracerProvider trace.TracerProvider
+
+	// shutdown holds the cleanup hooks run once the drain starts.
+	shutdown ShutdownManager
+	// workers drains /enqueue jobs; nil when NUM_WORKERS is 0.
+	workers *workerPool
+
+	// flushers write out buffered logs and metrics as the last hook.
+	flushers []namedFlusher
+}
+
+func newApp(cfg Config) *app {
+	a := &app{cfg: cfg, tracerProvider: noop.NewTracerProvider(), drained: make(chan struct{}), drainBegun: make(chan struct{}), shutdownRequested: make(chan struct{}), exit: os.Exit}
+	a.graceful.Store(cfg.Graceful)
+	a.rand = newRandSource(processSeed())
+	a.forcedHealthStatus.Store(int64(cfg.InitialHealthStatus))
+	// First in, so it runs after every other shutdown hook
+	a.shutdown.Register(a.flush)
+	// LoadConfig already rejected invalid EXTRA_FIELDS
+	a.extraFields, _ = parseExtraFields(cfg.ExtraFields)
+	a.filler = strings.Repeat("x", cfg.PayloadBytes)
+	a.history = newRequestHistory(cfg.RequestLogSize)
+	a.heartbeat.beat()
+	a.health.Timeout = cfg.HealthCheckTimeout
+	if cfg.HealthStaleness > 0 {
+		a.health.Register("heartbeat", heartbeatCheck(&a.heartbeat, cfg.HealthStaleness))
+	}
+	if cfg.UpstreamURL != "" {
+		a.downstream = newDownstreamClient(cfg.UpstreamURL, cfg.UpstreamRetries, cfg.UpstreamTimeout, cfg.CacheTTL)
+		a.health.Register("downstream", a.downstream.ping)
+		a.shutdown.Register(a.downstream.closeIdle)
+	}
+	if cfg.EndpointRemovalURL != "" {
+		a.removalWaiter = &HTTPRemovalWaiter{URL: cfg.EndpointRemovalURL, Interval: removalPollInterval}
+	}
+	if cfg.NumWorkers > 0 {
+		a.workers = newWorkerPool(cfg.NumWorkers)
+		a.shutdown.Register(a.workers.stop)
+	}
+	if cfg.ShutdownWebhookURL != "" {
+		a.webhook = newShutdownWebhook(cfg.ShutdownWebhookURL)
+	}
+	a.metrics = newMetrics(a)
+	return a
+}
+
+// newHTTPServer builds the http.Server for cfg, used by both the graceful
+// and non-graceful modes so the timeouts apply uniformly.
+func newHTTPServer(cfg Config, h http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           h,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		// Errors such as failed TLS handshakes go to slog, not stderr
+		ErrorLog: log.New(slogWriter{level: slog.LevelWarn, event: "http_server_error"}, "", 0),
+	}
+	if cfg.EnableH2C {
+		enableH2C(srv)
+	} else if cfg.TLSCertFile != "" {
+		configureHTTP2(srv)
+	}
+	return srv
+}
+
+func newRouter(a *app) *gin.Engine {
+	r := gin.New()
+	// A wrong method on a known path is a 405 with an Allow header, not a 404
+	r.HandleMethodNotAllowed = true
+	// Trust no proxy headers, so a client can't pick its own IP with
+	// X-Forwarded-For and dodge the per-client rate limit. A nil list
+	// can't fail to parse.
+	r.SetTrustedProxies(nil)
+	// STRICT_ROUTES=false redirects /health/ and /HEALTH to /health. Case
+	// has to be fixed before routing, which middleware can't do, so this
+	// uses gin's own case-insensitive lookup.
+	r.RedirectTrailingSlash = !a.cfg.StrictRoutes
+	r.RedirectFixedPath = !a.cfg.StrictRoutes
+	r.NoMethod(func(c *gin.Context) {
+		abortWithError(c, http.StatusMethodNotAllowed, codeMethodNotAllowed, "method not allowed; allowed: "+c.Writer.Header().Get("Allow"))
 	})
+	r.NoRoute(func(c *gin.Context) {
+		abortWithError(c, http.StatusNotFound, codeNotFound, "no route for "+c.Request.URL.Path)
+	})
+	// Outermost, so requests the middleware below sheds are recorded too
+	if a.cfg.RequestLogSize > 0 {
+		r.Use(recordHistory(a.history))
+	}
+	r.Use(requestID(), a.stampServer(), traceRequests(a.tracerProvider), requestLogger(a.cfg.LogProbes), a.metrics.instrument(),
+		cors(a.cfg.CORSAllowedOrigins), requireAPIKey(a.cfg.APIKey), a.rejectWhileDraining(),
+		rateLimit(a.cfg.RateLimitRPS, a.cfg.RateLimitBurst), limitInflightBytes(a.cfg.MaxInflightBytes, &a.inflightBytes),
+		limitConcurrency(a.cfg.MaxConcurrent, a.cfg.QueueWait, &a.queued, a.metrics.slotAcquireObserver()), a.trackInFlight(),
+		gzipResponses(a.cfg.GzipMinSize), recoverPanics())
 
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+	// /prestop sleeps for PRESTOP_DELAY by design, so only /api/data is bounded
+	r.GET("/api/data", routeTimeout(a.cfg.APIDataTimeout), clientTimeout(), a.handleAPIData)
+
+	r.GET("/events", a.handleEvents)
+	r.GET("/ws", a.handleWS)
+	r.GET("/stream", a.handleStream)
+	r.POST("/echo", limitBody(a.cfg.MaxBodyBytes), a.handleEcho)
+	r.GET("/poll", a.handlePoll)
+	r.POST("/poll", limitBody(a.cfg.MaxBodyBytes), a.handlePublish)
+	if a.workers != nil {
+		r.POST("/enqueue", a.handleEnqueue)
+	}
+
+	// Liveness: keeps returning 200 during drain so the pod isn't killed
+	// early, but fails when a registered check does, e.g. a stale heartbeat
+	// from a wedged process. Results are reused for HEALTH_CACHE_TTL so
+	// frequent probes don't hammer dependencies, except during shutdown,
+	// when every probe should see the current state.
+	health := func(c *gin.Context) {
+		if code := int(a.forcedHealthStatus.Load()); code != 0 {
+			a.probeResponse(c, code, gin.H{"status": "forced", "code": code})
+			return
+		}
+		ttl := a.cfg.HealthCacheTTL
+		if a.shuttingDown.Load() {
+			ttl = 0
+		}
+		checks, failing := a.health.RunCached(c.Request.Context(), ttl)
+		if len(failing) > 0 {
+			a.probeResponse(c, http.StatusServiceUnavailable, gin.H{"status": "unhealthy", "checks": checks, "failing": failing})
+			return
+		}
+		a.probeResponse(c, http.StatusOK, gin.H{"status": "healthy", "checks": checks})
+	}
+	// /healthz and /readyz are the paths many Helm charts probe by default
+	r.GET("/health", health)
+	r.GET("/healthz", health)
+
+	// Startup: fails until warmup is over, modelling a K8s startup probe
+	r.GET("/startup", func(c *gin.Context) {
+		if !a.started.Load() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "starting"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "started"})
+	})
+
+	// Readiness: fails as soon as shutdown starts so no new traffic is routed here
+	ready := func(c *gin.Context) {
+		if a.shuttingDown.Load() {
+			a.probeResponse(c, http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
+			return
+		}
+		if a.warming.Load() {
+			a.probeResponse(c, http.StatusServiceUnavailable, gin.H{"status": "warming_up"})
+			return
+		}
+		// Don't count this probe itself
+		if a.overloaded(a.inFlight.Load() - 1) {
+			a.probeResponse(c, http.StatusServiceUnavailable, gin.H{"status": "overloaded"})
+			return
+		}
+		if a.memoryPressure() {
+			a.probeResponse(c, http.StatusServiceUnavailable, gin.H{"status": "memory_pressure"})
+			return
+		}
+		a.probeResponse(c, http.StatusOK, gin.H{"status": "ready"})
+	}
+	r.GET("/ready", ready)
+	r.GET("/readyz", ready)
+
+	r.GET("/prestop", a.handlePrestop)
+
+	// One place to watch a pod move through a rolling update
+	r.GET("/lifecycle", func(c *gin.Context) {
+		state, since := a.lifecycle()
+		c.JSON(http.StatusOK, gin.H{"state": state, "since": since.Format(time.RFC3339Nano), "in_flight": a.inFlight.Load() - 1})
 	})
 
-	r.GET("/prestop", func(c *gin.Context) {
-		log.Println("preStop hook called — starting graceful drain")
-		// Sleep to allow K8s to remove this pod from endpoints
-		time.Sleep(5 * time.Second)
-		log.Println("preStop hook complete — ready for SIGTERM")
-		c.JSON(http.StatusOK, gin.H{"status": "drained"})
+	r.GET("/version", func(c *gin.Context) {
+		if a.cfg.HealthFormat == healthFormatText {
+			c.String(http.StatusOK, "version=%s commit=%s build_time=%s\n", version, commit, buildTime)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"version": version, "commit": commit, "build_time": buildTime})
+	})
+
+	r.GET("/config", func(c *gin.Context) {
+		c.JSON(http.StatusOK, a.cfg.redacted())
+	})
+
+	r.GET("/metrics", a.metrics.handler())
+	r.GET("/stats", a.handleStats)
+
+	r.GET("/debug/inflight", func(c *gin.Context) {
+		// Exclude this request from the count
+		c.JSON(http.StatusOK, gin.H{"in_flight": a.inFlight.Load() - 1})
+	})
+
+	if a.cfg.EnablePprof {
+		registerPprof(r)
+		r.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+	}
+	if a.cfg.EnableAdmin {
+		a.registerAdmin(r)
+	}
+
+	return r
+}
+
+// startWarmup marks the app as started once delay has elapsed.
+func (a *app) startWarmup(delay time.Duration) {
+	if delay <= 0 {
+		markNow(&a.lifecycleTimes.ready)
+		a.started.Store(true)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		markNow(&a.lifecycleTimes.ready)
+		a.started.Store(true)
+		slog.Info("warmup complete", "event", "warmup_complete", "warmup_delay", delay.String())
 	})
+}
 
-	graceful := os.Getenv("GRACEFUL")
+// handleAPIData serves /api/data, optionally enriched with the response
+// from the downstream service at UPSTREAM_URL.
+func (a *app) handleAPIData(c *gin.Context) {
+	// Simulate work with a random sleep in the configured range, stopping
+	// early if the client goes away so cancelled work doesn't hold up the drain
+	sleepMs := a.cfg.MinLatencyMs + a.rand.Intn(a.cfg.MaxLatencyMs-a.cfg.MinLatencyMs+1)
+	if deadline, ok := c.Request.Context().Deadline(); ok && time.Until(deadline) < time.Duration(sleepMs)*time.Millisecond {
+		// The work can't finish in time, so don't start it
+		abortWithError(c, http.StatusGatewayTimeout, codeTimeout, "request timed out")
+		return
+	}
+	timer := time.NewTimer(time.Duration(sleepMs) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+		abortContextDone(c)
+		return
+	}
 
-	if graceful == "true" {
-		log.Println("Starting server in GRACEFUL mode on :7000")
-		srv := &http.Server{
-			Addr:    ":7000",
-			Handler: r,
+	if a.cfg.ErrorRate > 0 && a.rand.Float64() < a.cfg.ErrorRate {
+		a.metrics.simulatedErrors.WithLabelValues().Inc()
+		abortWithError(c, http.StatusInternalServerError, codeSimulatedFailure, "simulated failure")
+		return
+	}
+
+	resp := gin.H{
+		"source":     "go-upstream",
+		"message":    "Hello from Go upstream service",
+		"latency_ms": sleepMs,
+		"timestamp":  time.Now().Format(time.RFC3339),
+		"request_id": c.GetString(requestIDKey),
+	}
+	if a.filler != "" {
+		resp["filler"] = a.filler
+	}
+	// EXTRA_FIELDS add to the response but never replace the core fields
+	for k, v := range a.extraFields {
+		if _, ok := resp[k]; !ok {
+			resp[k] = v
 		}
+	}
 
-		// Start server in a goroutine
-		go func() {
-			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				log.Fatalf("listen: %s\n", err)
+	if a.downstream != nil {
+		body, err := a.downstream.fetch(c.Request.Context())
+		if err != nil && c.Request.Context().Err() != nil {
+			abortContextDone(c)
+			return
+		}
+		if err != nil {
+			// Degrade to the last good answer rather than failing outright
+			if cached, ok := a.downstream.cached(); ok {
+				requestLog(c).Warn("serving cached downstream response", "event", "downstream_cache_hit", "url", a.downstream.url, "error", err)
+				c.Header("X-Served-From-Cache", "true")
+				body, err = cached, nil
 			}
-		}()
+		}
+		if errors.Is(err, errCircuitOpen) {
+			abortWithError(c, http.StatusServiceUnavailable, codeCircuitOpen, err.Error())
+			return
+		}
+		if errors.Is(err, errUpstreamTimeout) {
+			requestLog(c).Warn("downstream call timed out", "event", "downstream_timeout", "url", a.downstream.url, "timeout_ms", a.cfg.UpstreamTimeout.Milliseconds())
+			abortWithError(c, http.StatusGatewayTimeout, codeTimeout, err.Error())
+			return
+		}
+		if err != nil {
+			requestLog(c).Warn("downstream call failed", "event", "downstream_failed", "url", a.downstream.url, "error", err)
+			abortWithError(c, http.StatusBadGateway, codeDownstreamFailed, err.Error())
+			return
+		}
+		resp["downstream"] = body
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleEcho returns the request body as-is. It exists to show the
+// MAX_BODY_BYTES limit on a route that reads a body.
+func (a *app) handleEcho(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		abortBodyTooLarge(c, a.cfg.MaxBodyBytes)
+		return
+	}
+	if err != nil {
+		abortContextDone(c)
+		return
+	}
+	contentType := c.ContentType()
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// errForcedShutdown is returned by serveGraceful when a second signal cut
+// the drain short.
+var errForcedShutdown = errors.New("forced shutdown by second signal")
+
+// errAbruptExit is returned by serveGraceful when graceful mode was off
+// and the process was told to exit at once. Outside tests a.exit does not
+// return, so callers never see it.
+var errAbruptExit = errors.New("non-graceful exit")
+
+// serveGraceful waits out STARTUP_DELAY, binds, and runs the warmup hooks
+// while /ready fails, then serves srv until a shutdown signal arrives. A
+// signal before the warmups finish returns errShutdownDuringStartup,
+// closing the listener if it was already bound. In graceful mode a signal
+// gives in-flight requests up to the configured shutdown timeout to
+// complete, and a second signal during the drain closes all connections
+// immediately. With graceful mode off it exits on the spot, the way a
+// process without signal handling dies on SIGTERM. The mode is read when
+// the signal arrives, so it can be flipped at runtime via /admin/graceful.
+func (a *app) serveGraceful(srv *http.Server) error {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, a.cfg.shutdownSignals()...)
+	defer signal.Stop(quit)
+
+	// SIGQUIT is diagnostic only: dump goroutines and keep serving
+	defer dumpStacksOnSIGQUIT(os.Stderr)()
+
+	if err := a.coldStartOrQuit(quit); err != nil {
+		return err
+	}
+	l, err := a.listen(srv)
+	if err != nil {
+		fatal("listen failed", "event", "listen_failed", "error", err)
+	}
+	slog.Info("listening", "event", "listening", "addr", l.Addr().String())
+	defer a.startSelfCheck(l.Addr(), selfCheckInterval)()
+
+	// Start server in a goroutine
+	go func() {
+		if err := a.serve(srv, l); err != nil && err != http.ErrServerClosed {
+			fatal("serve failed", "event", "listen_failed", "error", err)
+		}
+	}()
+	// /ready only passed once warmed up, so nothing needs draining yet
+	if err := a.warmupOrQuit(quit); err != nil {
+		srv.Close()
+		return err
+	}
+
+	// Wait for one of SHUTDOWN_SIGNALS or POST /admin/shutdown. A dry run
+	// only rehearses signals; the admin endpoint still shuts down for real.
+	sig := a.waitForShutdownRequest(quit)
+	for a.cfg.DryRunShutdown && sig != nil {
+		a.rehearseShutdown()
+		sig = a.waitForShutdownRequest(quit)
+	}
+	if !a.graceful.Load() {
+		slog.Warn("graceful mode is off — exiting immediately", "event", "shutdown_abrupt", "in_flight", a.inFlight.Load())
+		a.exit(exitCodeForSignal(sig))
+		srv.Close()
+		return errAbruptExit
+	}
+	start := time.Now()
+	varShutdowns.Add(1)
+
+	// Give in-flight requests and resource cleanup up to the shutdown
+	// timeout to complete. A second signal cancels it early so the lame
+	// duck, the WebSocket wait and the shutdown hooks stop waiting too.
+	timeoutCtx, cancelTimeout := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
+	defer cancelTimeout()
+	ctx, cancel := context.WithCancel(timeoutCtx)
+	defer cancel()
+
+	slog.Info("shutting down gracefully", "event", "shutdown_started", "timeout_ms", a.cfg.ShutdownTimeout.Milliseconds())
+	if a.webhook != nil {
+		a.webhook.notifyStarted()
+	}
+	logRuntime("drain_runtime_start")
+	go a.logInFlight(ctx, start)
+
+	// A second signal bails out of a hung drain by closing every connection
+	forced := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-quit:
+			slog.Warn("received second signal — forcing shutdown", "event", "shutdown_forced", "signal", sig.String())
+			close(forced)
+			cancel()
+			srv.Close()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = a.runShutdownPhases(ctx, srv)
+	select {
+	case <-forced:
+		err = errForcedShutdown
+	default:
+	}
+	elapsed := time.Since(start)
+	outcome := shutdownOutcome(err)
+	a.metrics.shutdownDuration.Set(elapsed.Seconds())
+	a.metrics.shutdownOutcomes.WithLabelValues(outcome).Inc()
+	// The metrics die with the process, so this line is the lasting record
+	slog.Info("shutdown finished", "event", "shutdown_complete", "outcome", outcome,
+		"shutdown_duration_ms", elapsed.Milliseconds(), "clean", err == nil)
+	logRuntime("drain_runtime_end")
+	if a.webhook != nil {
+		a.webhook.notifyComplete()
+	}
+	return err
+}
+
+// shutdownExitCode is the exit status for a shutdown that ended with err:
+// TIMEOUT_EXIT_CODE when the drain ran out of time, 1 for anything else
+// such as a second signal, and 0 when it was clean.
+func shutdownExitCode(cfg Config, err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case shutdownOutcome(err) == "timeout":
+		return cfg.TimeoutExitCode
+	default:
+		return 1
+	}
+}
+
+// shutdownOutcome classifies the error from a shutdown as "forced" by a
+// second signal, "timeout" when SHUTDOWN_TIMEOUT ran out, or "clean".
+func shutdownOutcome(err error) string {
+	switch {
+	case errors.Is(err, errForcedShutdown):
+		return "forced"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "clean"
+	}
+}
 
-		// Wait for SIGTERM or SIGINT
-		quit := make(chan os.Signal, 1)
-		signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
-		sig := <-quit
-		log.Printf("Received signal %v — shutting down gracefully...\n", sig)
+// draining reports whether shutdown has started and the lame-duck window
+// is over, so new work should be turned away and long work cut short.
+func (a *app) draining() bool {
+	return a.shuttingDown.Load() && !a.lameDuck.Load()
+}
+
+// checkDrained closes a.drained if the app is draining and no requests are
+// left in flight.
+func (a *app) checkDrained() {
+	if a.draining() && a.inFlight.Load() == 0 {
+		a.drainedOnce.Do(func() {
+			markNow(&a.lifecycleTimes.drained)
+			close(a.drained)
+		})
+	}
+}
 
-		// Give in-flight requests up to 15s to complete
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-		defer cancel()
+// logInFlight logs the in-flight request count every second until the
+// drain finishes or ctx is done. Finishing before the deadline is logged as
+// drain_complete_early, so an over-provisioned grace period shows up in the
+// logs.
+func (a *app) logInFlight(ctx context.Context, start time.Time) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
-		if err := srv.Shutdown(ctx); err != nil {
-			log.Fatalf("Server forced to shutdown: %v\n", err)
+	slog.Info("draining", "event", "draining", "in_flight", a.inFlight.Load())
+	for {
+		select {
+		case <-a.drained:
+			elapsed := time.Since(start)
+			slog.Info("drained before shutdown timeout", "event", "drain_complete_early",
+				"elapsed_ms", elapsed.Milliseconds(), "headroom_ms", (a.cfg.ShutdownTimeout - elapsed).Milliseconds())
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			slog.Info("draining", "event", "draining", "in_flight", a.inFlight.Load(),
+				"conns_active", a.conns.active.Load(), "conns_idle", a.conns.idle.Load())
 		}
-		log.Println("Server exited gracefully")
-	} else {
-		log.Println("Starting server in NON-GRACEFUL mode on :7000")
-		fmt.Println("(No signal handling — will terminate abruptly on SIGTERM)")
-		if err := r.Run(":7000"); err != nil {
-			log.Fatalf("Failed to start server: %v\n", err)
+	}
+}
+
+func main() {
+	mode := flag.String("mode", "server", `"server" to serve HTTP, "loadgen" to generate load against -url`)
+	var lg loadgenOptions
+	lg.register(flag.CommandLine)
+	flag.Parse()
+
+	switch *mode {
+	case "server":
+	case "loadgen":
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+		defer stop()
+		fmt.Printf("Sending load to %s for %s with %d workers...\n", lg.URL, lg.Duration, lg.Concurrency)
+		runLoad(ctx, &http.Client{Timeout: 10 * time.Second}, lg.URL, lg.Concurrency, lg.Duration).print(os.Stdout)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -mode %q\n", *mode)
+		os.Exit(2)
+	}
+
+	cfg, err := LoadConfig()
+	slog.SetDefault(newLogger(os.Stdout, cfg.LogLevel))
+	gin.DefaultWriter = slogWriter{level: slog.LevelDebug, event: "gin"}
+	gin.DefaultErrorWriter = slogWriter{level: slog.LevelError, event: "gin"}
+	if err != nil {
+		fatal("invalid configuration", "event", "config_invalid", "error", err)
+	}
+
+	slog.Info("configuration loaded", "event", "config", "config", cfg.redacted())
+	for _, w := range cfg.warnings() {
+		slog.Warn(w, "event", "config_warning")
+	}
+	if cfg.AutoBudget {
+		slog.Info("shutdown budget allocated from GRACE_BUDGET", "event", "grace_budget", "budget", cfg.budgetBreakdown())
+	}
+
+	if err := run(context.Background(), cfg); errors.Is(err, errShutdownDuringStartup) {
+		slog.Info("server exited before serving", "event", "exit")
+		return
+	} else if err != nil {
+		// The shutdown hooks, flushers included, have already run
+		code := shutdownExitCode(cfg, err)
+		slog.Error("server forced to shutdown", "event", "shutdown_forced", "exit_code", code, "error", err)
+		os.Exit(code)
+	}
+	slog.Info("server exited gracefully", "event", "exit")
+}
+
+// run serves cfg until a shutdown signal, POST /admin/shutdown, or ctx
+// being cancelled, and returns once the shutdown finishes. It is main
+// minus flag parsing and logger setup, so tests can start the real server.
+func run(ctx context.Context, cfg Config) error {
+	a := newApp(cfg)
+	if cfg.OTLPEndpoint != "" {
+		tp, err := newTracerProvider(ctx, cfg.OTLPEndpoint)
+		if err != nil {
+			fatal("tracing setup failed", "event", "tracing_failed", "error", err)
 		}
+		a.tracerProvider = tp
+		// Closed after the HTTP drain, flushing the spans of the last requests
+		a.shutdown.Register(tp.Shutdown)
+	}
+	a.RegisterFlusher("log", fileFlusher{os.Stdout})
+	a.startBackgroundJob("heartbeat_logger", backgroundJobInterval, a.logHeartbeatJob)
+	if cfg.RuntimeSampleInterval > 0 {
+		a.startBackgroundJob("runtime_sampler", cfg.RuntimeSampleInterval, a.sampleRuntimeJob)
+	}
+	srv := newHTTPServer(cfg, newRouter(a))
+	srv.ConnState = a.conns.track
+	a.startWarmup(cfg.WarmupDelay)
+	defer a.startHeartbeat()()
+
+	tls := cfg.TLSCertFile != ""
+	addr := cfg.Addr
+	if cfg.ListenSocket != "" {
+		addr = "unix:" + cfg.ListenSocket
+	}
+	serveMode := "graceful"
+	if !cfg.Graceful {
+		serveMode = "non-graceful"
+	}
+	slog.Info("starting server", "event", "startup", "version", version, "mode", serveMode, "addr", addr, "tls", tls)
+	// Cancelling ctx drains like POST /admin/shutdown
+	defer context.AfterFunc(ctx, func() { a.requestShutdown() })()
+	return a.serveGraceful(srv)
+}
+
+// exitCodeForSignal is the status a shell reports for a process killed by
+// sig (128 + signal number), so the abrupt path looks like the default
+// signal disposition. Admin-triggered exits have no signal and use 1.
+func exitCodeForSignal(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
 	}
+	return 1
 }
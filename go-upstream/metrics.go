@@ -0,0 +1,215 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// durationBuckets resolves the 100-200ms /api/data range finely and still
+// has room for the 5s /prestop sleep.
+var durationBuckets = []float64{
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.125, 0.15, 0.175, 0.2, 0.25, 0.5, 1, 2.5, 5, 7.5, 10,
+}
+
+type metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+
+	// Unlabelled vecs rather than a plain Counter and Histogram, which
+	// have no way to be zeroed by reset.
+	simulatedErrors  *prometheus.CounterVec
+	slotAcquire      *prometheus.HistogramVec
+	shutdownDuration prometheus.Gauge
+	shutdownOutcomes *prometheus.CounterVec
+
+	// Updated every RUNTIME_SAMPLE_INTERVAL by the runtime sampler job.
+	goroutines prometheus.Gauge
+	heapAlloc  prometheus.Gauge
+	sysMemory  prometheus.Gauge
+
+	// latencies backs /stats with recent percentiles for application routes.
+	latencies latencyStats
+}
+
+func newMetrics(a *app) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total HTTP requests by route and status code.",
+		}, []string{"path", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by route.",
+			Buckets: durationBuckets,
+		}, []string{"path"}),
+		simulatedErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simulated_errors_total",
+			Help: "Requests to /api/data failed on purpose by ERROR_RATE.",
+		}, nil),
+		slotAcquire: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "slot_acquire_seconds",
+			Help:    "Time requests spent waiting for a MAX_CONCURRENT slot, 0 for those admitted at once.",
+			Buckets: durationBuckets,
+		}, nil),
+		shutdownDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "shutdown_duration_seconds",
+			Help: "Wall-clock time from the shutdown signal until all shutdown phases completed.",
+		}),
+		shutdownOutcomes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shutdown_outcomes_total",
+			Help: "Shutdowns by how they ended: clean, timeout, or forced.",
+		}, []string{"outcome"}),
+		goroutines: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "sampled_goroutines",
+			Help: "Goroutine count at the last runtime sample.",
+		}),
+		heapAlloc: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "sampled_heap_alloc_bytes",
+			Help: "Bytes of allocated heap objects at the last runtime sample.",
+		}),
+		sysMemory: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "sampled_sys_bytes",
+			Help: "Bytes of memory obtained from the OS at the last runtime sample.",
+		}),
+	}
+	m.recordRuntime(sampleRuntime())
+	m.initUnlabelled()
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.duration,
+		m.simulatedErrors,
+		m.slotAcquire,
+		m.shutdownDuration,
+		m.shutdownOutcomes,
+		m.goroutines,
+		m.heapAlloc,
+		m.sysMemory,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests currently being served.",
+		}, func() float64 { return float64(a.inFlight.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "http_request_oldest_in_flight_seconds",
+			Help: "Age of the longest-running request still in flight, 0 when idle.",
+		}, func() float64 {
+			if reqs := a.activeRequests(); len(reqs) > 0 {
+				return time.Since(reqs[0].start).Seconds()
+			}
+			return 0
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "http_connections",
+			Help:        "Open connections by state.",
+			ConstLabels: prometheus.Labels{"state": "new"},
+		}, func() float64 { return float64(a.conns.new.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "http_connections",
+			Help:        "Open connections by state.",
+			ConstLabels: prometheus.Labels{"state": "active"},
+		}, func() float64 { return float64(a.conns.active.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "http_connections",
+			Help:        "Open connections by state.",
+			ConstLabels: prometheus.Labels{"state": "idle"},
+		}, func() float64 { return float64(a.conns.idle.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "http_connections_ended_total",
+			Help:        "Connections that were closed or hijacked.",
+			ConstLabels: prometheus.Labels{"how": "closed"},
+		}, func() float64 { return float64(a.conns.closed.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "http_connections_ended_total",
+			Help:        "Connections that were closed or hijacked.",
+			ConstLabels: prometheus.Labels{"how": "hijacked"},
+		}, func() float64 { return float64(a.conns.hijacked.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "concurrency_queue_depth",
+			Help: "Requests waiting for a MAX_CONCURRENT slot.",
+		}, func() float64 { return float64(a.queued.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "http_inflight_bytes",
+			Help: "Request and response bytes of the requests being served, checked against MAX_INFLIGHT_BYTES.",
+		}, func() float64 { return float64(a.inflightBytes.Load()) }),
+	)
+	if a.downstream != nil {
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "downstream_circuit_state",
+			Help: "Downstream circuit breaker state: 0 closed, 1 open, 2 half-open.",
+		}, func() float64 { return float64(a.downstream.breaker.State()) }))
+	}
+	return m
+}
+
+// initUnlabelled creates the single series of each unlabelled vec, so it
+// is exported as 0 before anything is recorded.
+func (m *metrics) initUnlabelled() {
+	m.simulatedErrors.WithLabelValues()
+	m.slotAcquire.WithLabelValues()
+}
+
+// reset zeroes the app's own request, error, shutdown, and /stats figures
+// so repeated load tests against one process can be compared. The Go and
+// process collectors, the runtime samples, and the gauges and counters
+// read live from app state (in-flight requests, connections) are current
+// values, not accumulations, and are left alone.
+func (m *metrics) reset() {
+	m.requests.Reset()
+	m.duration.Reset()
+	m.simulatedErrors.Reset()
+	m.slotAcquire.Reset()
+	m.shutdownOutcomes.Reset()
+	m.shutdownDuration.Set(0)
+	m.initUnlabelled()
+	m.latencies.reset()
+	// /debug/vars mirrors http_requests_total, so it starts over too
+	varRequests.Set(0)
+}
+
+// slotAcquireObserver looks the series up on every observation, since
+// reset replaces it.
+func (m *metrics) slotAcquireObserver() prometheus.Observer {
+	return prometheus.ObserverFunc(func(v float64) { m.slotAcquire.WithLabelValues().Observe(v) })
+}
+
+func (m *metrics) recordRuntime(s runtimeSample) {
+	m.goroutines.Set(float64(s.goroutines))
+	m.heapAlloc.Set(float64(s.heapAlloc))
+	m.sysMemory.Set(float64(s.sys))
+}
+
+// instrument records the request count and latency for every route.
+func (m *metrics) instrument() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// Use the route template, not the raw URL, to keep label cardinality bounded
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		elapsed := time.Since(start)
+		m.requests.WithLabelValues(path, strconv.Itoa(c.Writer.Status())).Inc()
+		varRequests.Add(1)
+		m.duration.WithLabelValues(path).Observe(elapsed.Seconds())
+		if !operationalRoute(path) {
+			m.latencies.record(elapsed)
+		}
+	}
+}
+
+// handler serves the registry in the OpenMetrics format to scrapers that
+// ask for it in Accept, and the Prometheus text format otherwise.
+func (m *metrics) handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+}
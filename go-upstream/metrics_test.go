@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsCountsAPIDataRequests(t *testing.T) {
+	r := newRouter(newApp(defaultConfig()))
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/data", nil))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/metrics status = %d, want 200", w.Code)
+	}
+
+	body := w.Body.String()
+	want := `http_requests_total{path="/api/data",status="200"} 1`
+	if !strings.Contains(body, want) {
+		t.Errorf("/metrics missing %q", want)
+	}
+	for _, name := range []string{"http_request_duration_seconds_bucket", "http_requests_in_flight", "http_request_oldest_in_flight_seconds"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("/metrics missing %s", name)
+		}
+	}
+}
+
+func TestAdminMetricsResetZeroesAppMetrics(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.EnableAdmin = true
+	cfg.EnablePprof = true
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	cfg.ErrorRate = 1
+	a := newApp(cfg)
+	r := newRouter(a)
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/data", nil))
+	if got := testutil.ToFloat64(a.metrics.simulatedErrors); got != 1 {
+		t.Fatalf("simulated_errors_total before reset = %v, want 1", got)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/metrics/reset", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /admin/metrics/reset = %d, want 200", w.Code)
+	}
+	if got := testutil.ToFloat64(a.metrics.simulatedErrors); got != 0 {
+		t.Errorf("simulated_errors_total after reset = %v, want 0", got)
+	}
+	// Only the reset request itself has been counted since
+	if got := readVars(t, r)["requests_total"].(float64); got != 1 {
+		t.Errorf("/debug/vars requests_total after reset = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(a.metrics.requests.WithLabelValues("/admin/metrics/reset", "200")); got != 1 {
+		t.Errorf("http_requests_total for the reset = %v, want 1", got)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	if strings.Contains(body, `http_requests_total{path="/api/data"`) {
+		t.Error("/api/data request count survived the reset")
+	}
+	for _, name := range []string{"simulated_errors_total 0", "go_goroutines", "process_start_time_seconds"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("/metrics after reset missing %s", name)
+		}
+	}
+}
+
+func TestShutdownDurationCoversSlowHandler(t *testing.T) {
+	a := newApp(shutdownTestConfig())
+	r := newRouter(a)
+
+	const latency = 300 * time.Millisecond
+	started := make(chan struct{})
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(latency)
+		c.Status(http.StatusOK)
+	})
+
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: r}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+
+	go func() {
+		if resp, err := http.Get("http://" + addr + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	sendSignal(t, syscall.SIGTERM)
+
+	if err := <-done; err != nil {
+		t.Fatalf("serveGraceful: %v", err)
+	}
+	// The signal lands shortly after the handler starts, so allow a little slack.
+	got := testutil.ToFloat64(a.metrics.shutdownDuration)
+	if min := (latency - 50*time.Millisecond).Seconds(); got < min {
+		t.Errorf("shutdown_duration_seconds = %.3f, want >= %.3f", got, min)
+	}
+}
+
+func TestMetricsNegotiatesOpenMetrics(t *testing.T) {
+	r := newRouter(newApp(defaultConfig()))
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("Content-Type = %q, want application/openmetrics-text", ct)
+	}
+	if !strings.HasSuffix(w.Body.String(), "# EOF\n") {
+		t.Error("OpenMetrics body does not end with # EOF")
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("default Content-Type = %q, want text/plain", ct)
+	}
+	if strings.Contains(w.Body.String(), "# EOF") {
+		t.Error("Prometheus text format should not carry # EOF")
+	}
+}
+
+func TestRuntimeSamplerReportsGoroutines(t *testing.T) {
+	a := newApp(defaultConfig())
+	r := newRouter(a)
+	a.startBackgroundJob("runtime_sampler", 10*time.Millisecond, a.sampleRuntimeJob)
+	for i := 0; i < 3; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if n := testutil.ToFloat64(a.metrics.goroutines); n < 1 || n > 10000 {
+		t.Errorf("sampled_goroutines = %v, want a plausible count", n)
+	}
+	if b := testutil.ToFloat64(a.metrics.heapAlloc); b <= 0 {
+		t.Errorf("sampled_heap_alloc_bytes = %v, want > 0", b)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, name := range []string{"sampled_goroutines", "sampled_heap_alloc_bytes", "sampled_sys_bytes"} {
+		if !strings.Contains(w.Body.String(), name) {
+			t.Errorf("/metrics missing %s", name)
+		}
+	}
+}
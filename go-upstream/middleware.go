@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// trackInFlight counts requests currently being served so the shutdown
+// path can report how much work is still draining and when it is done.
+func (a *app) trackInFlight() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if streamingRoute(c.FullPath()) {
+			c.Next()
+			return
+		}
+		id := a.requestSeq.Add(1)
+		a.active.Store(id, activeRequest{
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			RequestID: c.GetString(requestIDKey),
+			start:     time.Now(),
+		})
+		a.inFlight.Add(1)
+		varInFlight.Add(1)
+		defer func() {
+			a.active.Delete(id)
+			a.inFlight.Add(-1)
+			varInFlight.Add(-1)
+			a.checkDrained()
+		}()
+		c.Next()
+	}
+}
+
+// activeRequest is one entry in app.active.
+type activeRequest struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	RequestID string `json:"request_id"`
+	AgeMs     int64  `json:"age_ms"`
+	start     time.Time
+}
+
+// activeRequests snapshots the requests still in flight, oldest first.
+func (a *app) activeRequests() []activeRequest {
+	var reqs []activeRequest
+	a.active.Range(func(_, v any) bool {
+		r := v.(activeRequest)
+		r.AgeMs = time.Since(r.start).Milliseconds()
+		reqs = append(reqs, r)
+		return true
+	})
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].AgeMs > reqs[j].AgeMs })
+	return reqs
+}
+
+// operationalRoute reports whether a route is a probe, metrics, or debug
+// endpoint. These must keep answering during drain and under load: probes
+// report their own state and the rest are how operators observe the pod.
+func operationalRoute(path string) bool {
+	switch path {
+	case "/health", "/healthz", "/ready", "/readyz", "/startup", "/lifecycle", "/metrics", "/stats":
+		return true
+	}
+	return strings.HasPrefix(path, "/debug/")
+}
+
+// rejectWhileDraining turns away requests that arrive after shutdown has
+// started and the lame-duck window is over. Requests already past this
+// middleware are left to finish.
+func (a *app) rejectWhileDraining() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a.draining() && !operationalRoute(c.FullPath()) {
+			c.Header("Retry-After", "5")
+			abortWithError(c, http.StatusServiceUnavailable, codeShuttingDown, "server is shutting down")
+			return
+		}
+		c.Next()
+	}
+}
+
+// recoverPanics turns a handler panic into a structured error log and a
+// clean 500. It sits innermost so the outer middleware (metrics, in-flight
+// tracking, access log) still see the request complete normally.
+func recoverPanics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if v := recover(); v != nil {
+				requestLog(c).Error("panic recovered",
+					"event", "panic",
+					"method", c.Request.Method,
+					"path", c.Request.URL.Path,
+					"panic", fmt.Sprint(v),
+					"stack", string(debug.Stack()),
+				)
+				abortWithError(c, http.StatusInternalServerError, codeInternal, "internal server error")
+			}
+		}()
+		c.Next()
+	}
+}
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+)
+
+// requestID tags each request with the inbound X-Request-ID, or a fresh
+// UUID when there is none, and echoes it back on the response.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" {
+			id = uuid.NewString()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// stampServer sets X-Served-By to the hostname (the pod name in K8s) on
+// every response, plus X-Draining: true once shutdown has started, so a
+// load test can attribute each response to a pod and its state.
+func (a *app) stampServer() gin.HandlerFunc {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return func(c *gin.Context) {
+		c.Header("X-Served-By", host)
+		if a.shuttingDown.Load() {
+			c.Header("X-Draining", "true")
+		}
+		c.Next()
+	}
+}
+
+// defaultQueueWait is how long a request waits for a free slot before it
+// is shed.
+const defaultQueueWait = 100 * time.Millisecond
+
+// limitConcurrency caps concurrently executing handlers at max using a
+// buffered channel as a semaphore. Requests that find every slot taken
+// queue for up to wait; those still waiting then are shed with 503. The
+// queue holds at most max requests, so a burst beyond that is shed at
+// once, and queued counts how many are waiting. Every admitted request's
+// time to get a slot goes to acquire, and queued ones also log it, so
+// queueing can be told apart from handler latency. max <= 0 disables the
+// limit.
+func limitConcurrency(max int, wait time.Duration, queued *atomic.Int64, acquire prometheus.Observer) gin.HandlerFunc {
+	if max <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	slots := make(chan struct{}, max)
+	return func(c *gin.Context) {
+		if operationalRoute(c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		select {
+		case slots <- struct{}{}:
+			acquire.Observe(time.Since(start).Seconds())
+		default:
+			if queued.Add(1) > int64(max) {
+				queued.Add(-1)
+				requestLog(c).Warn("concurrency limit reached, shedding request", "event", "request_shed", "max_concurrent", max, "reason", "queue_full")
+				abortWithError(c, http.StatusServiceUnavailable, codeOverCapacity, "server at capacity, retry later")
+				return
+			}
+			ok := waitForSlot(c, slots, wait)
+			queued.Add(-1)
+			if !ok {
+				return
+			}
+			waited := time.Since(start)
+			acquire.Observe(waited.Seconds())
+			requestLog(c).Info("concurrency slot acquired after queueing", "event", "slot_acquired", "wait_ms", waited.Milliseconds(), "queued", queued.Load())
+		}
+		// Deferred so the slot comes back even if a handler panics
+		defer func() { <-slots }()
+		c.Next()
+	}
+}
+
+// waitForSlot blocks until a slot in slots is free, wait passes, or the
+// client goes away, aborting c in the last two cases. A cancelled request
+// leaves the queue straight away instead of holding its place.
+func waitForSlot(c *gin.Context, slots chan struct{}, wait time.Duration) bool {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		requestLog(c).Warn("concurrency limit reached, shedding request", "event", "request_shed", "max_concurrent", cap(slots), "reason", "queue_wait", "wait_ms", wait.Milliseconds())
+		abortWithError(c, http.StatusServiceUnavailable, codeOverCapacity, "server at capacity, retry later")
+	case <-c.Request.Context().Done():
+		abortWithError(c, statusClientClosedRequest, codeCancelled, "request cancelled")
+	}
+	return false
+}
+
+// defaultAPIDataTimeout bounds /api/data, including any downstream call.
+const defaultAPIDataTimeout = 3 * time.Second
+
+// routeTimeout gives a route its own deadline by wrapping the request
+// context. Handlers that watch the context end early and the client gets a
+// 504; the handler still runs on this goroutine, so the in-flight count is
+// released as usual. d <= 0 leaves the route unbounded.
+func routeTimeout(d time.Duration) gin.HandlerFunc {
+	if d <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return func(c *gin.Context) { nextWithTimeout(c, d) }
+}
+
+const (
+	timeoutHeader = "X-Timeout-Ms"
+	// maxClientTimeout caps the deadline a client can ask for.
+	maxClientTimeout = 30 * time.Second
+)
+
+// clientTimeout applies the deadline a caller asks for in X-Timeout-Ms,
+// capped at maxClientTimeout. Nested inside routeTimeout, the shorter of
+// the two deadlines wins.
+func clientTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.GetHeader(timeoutHeader)
+		if raw == "" {
+			c.Next()
+			return
+		}
+		ms, err := strconv.Atoi(raw)
+		if err != nil || ms <= 0 {
+			abortWithError(c, http.StatusBadRequest, codeInvalidRequest, timeoutHeader+" must be a positive integer")
+			return
+		}
+		nextWithTimeout(c, min(time.Duration(ms)*time.Millisecond, maxClientTimeout))
+	}
+}
+
+// nextWithTimeout runs the rest of the chain with the request context
+// bounded by d, answering 504 if the deadline passed with nothing written.
+func nextWithTimeout(c *gin.Context, d time.Duration) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+	defer cancel()
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+
+	if !c.Writer.Written() && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		abortWithError(c, http.StatusGatewayTimeout, codeTimeout, "request timed out")
+	}
+}
+
+// abortContextDone ends a request whose context finished before the work
+// did: 504 if a routeTimeout deadline passed, 499 if the client went away.
+func abortContextDone(c *gin.Context) {
+	err := c.Request.Context().Err()
+	requestLog(c).Debug("request cancelled", "event", "request_cancelled", "path", c.FullPath(), "error", err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		abortWithError(c, http.StatusGatewayTimeout, codeTimeout, "request timed out")
+		return
+	}
+	abortWithError(c, statusClientClosedRequest, codeCancelled, "request cancelled")
+}
+
+const defaultMaxBodyBytes = 1 << 20
+
+// limitBody caps the request body at max bytes with http.MaxBytesReader.
+// Bodies that declare a larger Content-Length are refused up front; the
+// rest fail with *http.MaxBytesError once the handler reads past max.
+func limitBody(max int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > int64(max) {
+			abortBodyTooLarge(c, max)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(max))
+		c.Next()
+	}
+}
+
+// abortBodyTooLarge responds 413 for a body over the MAX_BODY_BYTES limit.
+func abortBodyTooLarge(c *gin.Context, max int) {
+	abortWithError(c, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", max))
+}
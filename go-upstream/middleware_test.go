@@ -0,0 +1,447 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTrackInFlightCountsActiveRequests(t *testing.T) {
+	a := newApp(defaultConfig())
+	r := newRouter(a)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	go r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	<-started
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/inflight", nil))
+	var body struct {
+		InFlight int64 `json:"in_flight"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.InFlight != 1 {
+		t.Errorf("in_flight = %d, want 1", body.InFlight)
+	}
+
+	close(release)
+}
+
+func TestRejectWhileDrainingReturns503ForNewRequests(t *testing.T) {
+	a := newApp(defaultConfig())
+	r := newRouter(a)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	// Started before drain, so it must be allowed to finish.
+	inFlight := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		r.ServeHTTP(inFlight, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		close(finished)
+	}()
+	<-started
+
+	a.shuttingDown.Store(true)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/data", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("new request status = %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Retry-After = %q, want 5", got)
+	}
+
+	if got := statusOf(r, "/health"); got != http.StatusOK {
+		t.Errorf("/health during drain = %d, want 200", got)
+	}
+
+	close(release)
+	<-finished
+	if inFlight.Code != http.StatusOK {
+		t.Errorf("pre-drain request status = %d, want 200", inFlight.Code)
+	}
+}
+
+func TestRecoverPanicsReturns500AndKeepsServing(t *testing.T) {
+	a := newApp(defaultConfig())
+	r := newRouter(a)
+	r.GET("/boom", func(c *gin.Context) { panic("boom") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/boom", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	assertErrorEnvelope(t, w, codeInternal)
+	if n := a.inFlight.Load(); n != 0 {
+		t.Errorf("inFlight after panic = %d, want 0", n)
+	}
+
+	if got := statusOf(r, "/health"); got != http.StatusOK {
+		t.Errorf("/health after panic = %d, want 200", got)
+	}
+}
+
+func TestRequestIDEchoesInboundHeader(t *testing.T) {
+	r := newRouter(newApp(defaultConfig()))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("X-Request-ID"); got != "abc-123" {
+		t.Errorf("X-Request-ID = %q, want abc-123", got)
+	}
+	var body struct {
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.RequestID != "abc-123" {
+		t.Errorf("request_id = %q, want abc-123", body.RequestID)
+	}
+}
+
+func TestRequestIDGeneratedWhenMissing(t *testing.T) {
+	r := newRouter(newApp(defaultConfig()))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if got := w.Header().Get("X-Request-ID"); len(got) != 36 {
+		t.Errorf("X-Request-ID = %q, want a generated UUID", got)
+	}
+}
+
+func TestLimitConcurrencyShedsExcessRequests(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MaxConcurrent = 2
+	r := newRouter(newApp(cfg))
+
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	r.GET("/slow", func(c *gin.Context) {
+		started.Done()
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	var finished sync.WaitGroup
+	for i := 0; i < cfg.MaxConcurrent; i++ {
+		started.Add(1)
+		finished.Add(1)
+		go func() {
+			defer finished.Done()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+		}()
+	}
+	started.Wait()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("excess request status = %d, want 503", w.Code)
+	}
+	if got := statusOf(r, "/health"); got != http.StatusOK {
+		t.Errorf("/health while saturated = %d, want 200", got)
+	}
+
+	close(release)
+	finished.Wait()
+}
+
+func TestLimitConcurrencyQueuesWithinQueueWait(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MaxConcurrent = 2
+	cfg.QueueWait = 2 * time.Second
+	a := newApp(cfg)
+	r := newRouter(a)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	r.GET("/slow", func(c *gin.Context) {
+		started <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	first := make(chan int, cfg.MaxConcurrent)
+	for i := 0; i < cfg.MaxConcurrent; i++ {
+		go func() { first <- statusOf(r, "/slow") }()
+		<-started
+	}
+
+	queued := make(chan int, 1)
+	go func() { queued <- statusOf(r, "/slow") }()
+	waitForQueueDepth(t, a, 1)
+
+	// A queued client that gives up must leave the queue straight away
+	ctx, cancel := context.WithCancel(context.Background())
+	gaveUp := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx))
+		gaveUp <- w
+	}()
+	waitForQueueDepth(t, a, 2)
+	cancel()
+	w := <-gaveUp
+	if w.Code != statusClientClosedRequest {
+		t.Errorf("cancelled queued request = %d, want %d", w.Code, statusClientClosedRequest)
+	}
+	assertErrorEnvelope(t, w, codeCancelled)
+	waitForQueueDepth(t, a, 1)
+
+	close(release)
+	for i := 0; i < cfg.MaxConcurrent; i++ {
+		if got := <-first; got != http.StatusOK {
+			t.Errorf("slot holder = %d, want 200", got)
+		}
+	}
+	if got := <-queued; got != http.StatusOK {
+		t.Errorf("queued request = %d, want 200 once the slot freed", got)
+	}
+	waitForQueueDepth(t, a, 0)
+}
+
+func TestLimitConcurrencyRecordsSlotWait(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := defaultConfig()
+	cfg.MaxConcurrent = 1
+	cfg.QueueWait = 2 * time.Second
+	a := newApp(cfg)
+	r := newRouter(a)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	r.GET("/slow", func(c *gin.Context) {
+		started <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	holder := make(chan int, 1)
+	go func() { holder <- statusOf(r, "/slow") }()
+	<-started
+	queued := make(chan int, 1)
+	go func() { queued <- statusOf(r, "/slow") }()
+	waitForQueueDepth(t, a, 1)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if <-holder != http.StatusOK || <-queued != http.StatusOK {
+		t.Fatal("saturating requests did not both succeed")
+	}
+
+	var waitMs int64 = -1
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry struct {
+			Event  string `json:"event"`
+			WaitMs int64  `json:"wait_ms"`
+		}
+		if json.Unmarshal([]byte(line), &entry) == nil && entry.Event == "slot_acquired" {
+			waitMs = entry.WaitMs
+		}
+	}
+	if waitMs <= 0 {
+		t.Errorf("slot_acquired wait_ms = %d, want the time spent queued", waitMs)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), "slot_acquire_seconds_count 2") {
+		t.Errorf("/metrics missing both slot acquisitions:\n%s", w.Body.String())
+	}
+}
+
+// waitForQueueDepth waits for a.queued to reach want.
+func waitForQueueDepth(t *testing.T, a *app, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for a.queued.Load() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth = %d, want %d", a.queued.Load(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLimitConcurrencyReleasesSlotOnPanic(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MaxConcurrent = 1
+	r := newRouter(newApp(cfg))
+	r.GET("/boom", func(c *gin.Context) { panic("boom") })
+	r.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	statusOf(r, "/boom")
+	if got := statusOf(r, "/ok"); got != http.StatusOK {
+		t.Errorf("request after panic = %d, want 200 (slot leaked)", got)
+	}
+}
+
+func TestRouteTimeout(t *testing.T) {
+	cases := []struct {
+		name    string
+		latency int
+		want    int
+	}{
+		{"fast request passes", 0, http.StatusOK},
+		{"slow request times out", 500, http.StatusGatewayTimeout},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.MinLatencyMs, cfg.MaxLatencyMs = tc.latency, tc.latency
+			cfg.APIDataTimeout = 50 * time.Millisecond
+			a := newApp(cfg)
+
+			start := time.Now()
+			if got := statusOf(newRouter(a), "/api/data"); got != tc.want {
+				t.Errorf("status = %d, want %d", got, tc.want)
+			}
+			if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+				t.Errorf("request took %s, want it cut off near the 50ms deadline", elapsed)
+			}
+			if n := a.inFlight.Load(); n != 0 {
+				t.Errorf("in-flight after request = %d, want 0", n)
+			}
+		})
+	}
+}
+
+func TestRouteTimeoutCoversHandlersThatIgnoreContext(t *testing.T) {
+	r := gin.New()
+	r.GET("/stuck", routeTimeout(10*time.Millisecond), func(c *gin.Context) {
+		time.Sleep(30 * time.Millisecond)
+	})
+	if got := statusOf(r, "/stuck"); got != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", got)
+	}
+}
+
+func TestEchoEnforcesMaxBodyBytes(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MaxBodyBytes = 16
+	r := newRouter(newApp(cfg))
+
+	cases := []struct {
+		name          string
+		body          string
+		contentLength int64
+		want          int
+	}{
+		{"within limit", "hello", 5, http.StatusOK},
+		{"declared too large", strings.Repeat("x", 32), 32, http.StatusRequestEntityTooLarge},
+		{"chunked too large", strings.Repeat("x", 32), -1, http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(tc.body))
+			req.ContentLength = tc.contentLength
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d, want %d", w.Code, tc.want)
+			}
+			if tc.want == http.StatusOK && w.Body.String() != tc.body {
+				t.Errorf("echoed %q, want %q", w.Body.String(), tc.body)
+			}
+		})
+	}
+}
+
+func TestAPIDataHonorsClientTimeoutHeader(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 150, 150
+	r := newRouter(newApp(cfg))
+
+	cases := []struct {
+		header string
+		want   int
+	}{
+		{"50", http.StatusGatewayTimeout},
+		{"1000", http.StatusOK},
+		{"", http.StatusOK},
+		{"soon", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+		if tc.header != "" {
+			req.Header.Set(timeoutHeader, tc.header)
+		}
+		w := httptest.NewRecorder()
+		start := time.Now()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s=%q: status = %d, want %d", timeoutHeader, tc.header, w.Code, tc.want)
+		}
+		if tc.want == http.StatusGatewayTimeout && time.Since(start) > 100*time.Millisecond {
+			t.Errorf("%s=%q: took %s, want to give up within the 50ms budget", timeoutHeader, tc.header, time.Since(start))
+		}
+	}
+}
+
+func TestClientTimeoutIsCappedByRouteTimeout(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 150, 150
+	cfg.APIDataTimeout = 50 * time.Millisecond
+	r := newRouter(newApp(cfg))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+	req.Header.Set(timeoutHeader, "10000")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504 from the 50ms route timeout", w.Code)
+	}
+}
+
+func TestStampServerSetsIdentityAndDrainHeaders(t *testing.T) {
+	a := newApp(defaultConfig())
+	r := newRouter(a)
+	host, _ := os.Hostname()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if got := w.Header().Get("X-Served-By"); got != host {
+		t.Errorf("X-Served-By = %q, want %q", got, host)
+	}
+	if got := w.Header().Get("X-Draining"); got != "" {
+		t.Errorf("X-Draining before shutdown = %q, want unset", got)
+	}
+
+	a.shuttingDown.Store(true)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if got := w.Header().Get("X-Draining"); got != "true" {
+		t.Errorf("X-Draining during drain = %q, want true", got)
+	}
+	if got := w.Header().Get("X-Served-By"); got != host {
+		t.Errorf("X-Served-By during drain = %q, want %q", got, host)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pollTimeout is how long GET /poll waits for an event before answering
+// 204 so the client polls again.
+const pollTimeout = 30 * time.Second
+
+// pollHub wakes every waiting GET /poll when POST /poll publishes an event.
+type pollHub struct {
+	mu   sync.Mutex
+	next *pollRound
+}
+
+// pollRound is one publish: done is closed once event is set.
+type pollRound struct {
+	done  chan struct{}
+	event string
+}
+
+// wait returns the round the next publish completes.
+func (h *pollHub) wait() *pollRound {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.next == nil {
+		h.next = &pollRound{done: make(chan struct{})}
+	}
+	return h.next
+}
+
+// publish hands event to every current waiter and reports whether there
+// were any.
+func (h *pollHub) publish(event string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.next == nil {
+		return false
+	}
+	h.next.event = event
+	close(h.next.done)
+	h.next = nil
+	return true
+}
+
+// handlePoll long-polls for the next POST /poll event. A waiting poll
+// counts as in flight but would otherwise hold the drain for up to
+// pollTimeout, so it returns 204 as soon as the drain begins and the
+// client reconnects to another pod.
+func (a *app) handlePoll(c *gin.Context) {
+	// The wait is meant to outlive WRITE_TIMEOUT
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	round := a.polls.wait()
+	timer := time.NewTimer(pollTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-round.done:
+		c.JSON(http.StatusOK, gin.H{"event": round.event})
+	case <-timer.C:
+		c.Status(http.StatusNoContent)
+	case <-a.drainBegun:
+		requestLog(c).Info("long poll released by shutdown", "event", "poll_interrupted")
+		c.Status(http.StatusNoContent)
+	case <-c.Request.Context().Done():
+	}
+}
+
+// handlePublish wakes every waiting poll with the request body as the event.
+func (a *app) handlePublish(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		abortBodyTooLarge(c, a.cfg.MaxBodyBytes)
+		return
+	}
+	if err != nil {
+		abortContextDone(c)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"woken": a.polls.publish(string(body))})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPollReceivesPublishedEvent(t *testing.T) {
+	a := newApp(defaultConfig())
+	r := newRouter(a)
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/poll", nil))
+		done <- w
+	}()
+	waitForConns(t, "poll in flight", func() bool { return a.inFlight.Load() == 1 })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/poll", strings.NewReader("deployed")))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"woken":true`) {
+		t.Fatalf("POST /poll = %d %s, want 200 woken", w.Code, w.Body.String())
+	}
+
+	select {
+	case w := <-done:
+		var body struct{ Event string }
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK || body.Event != "deployed" {
+			t.Fatalf("GET /poll = %d %s, want 200 with the event", w.Code, w.Body.String())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("poll was not woken by the publish")
+	}
+}
+
+func TestShutdownReleasesLongPoll(t *testing.T) {
+	cfg := shutdownTestConfig()
+	cfg.Addr = freeAddr(t)
+	a := newApp(cfg)
+	srv := newHTTPServer(cfg, newRouter(a))
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	base := "http://" + cfg.Addr
+	waitForServer(t, base+"/health")
+
+	type result struct {
+		code int
+		err  error
+	}
+	polled := make(chan result, 1)
+	// A pooled client can leave a spare connection that Shutdown only
+	// treats as idle after 5s
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	go func() {
+		resp, err := client.Get(base + "/poll")
+		if err != nil {
+			polled <- result{err: err}
+			return
+		}
+		resp.Body.Close()
+		polled <- result{code: resp.StatusCode}
+	}()
+	waitForConns(t, "poll in flight", func() bool { return a.inFlight.Load() == 1 })
+
+	sendSignal(t, syscall.SIGTERM)
+	select {
+	case res := <-polled:
+		if res.err != nil || res.code != http.StatusNoContent {
+			t.Fatalf("poll during shutdown = %d, %v; want 204", res.code, res.err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("long poll still held after the drain began")
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveGraceful: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown did not finish after the poll was released")
+	}
+}
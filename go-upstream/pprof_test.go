@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPprofRoutesOnlyWhenEnabled(t *testing.T) {
+	paths := []string{"/debug/pprof/", "/debug/pprof/goroutine", "/debug/pprof/cmdline", "/debug/vars"}
+
+	cfg := defaultConfig()
+	cfg.EnablePprof = true
+	enabled := newRouter(newApp(cfg))
+	for _, p := range paths {
+		if got := statusOf(enabled, p); got != http.StatusOK {
+			t.Errorf("enabled: %s = %d, want 200", p, got)
+		}
+	}
+
+	disabled := newRouter(newApp(defaultConfig()))
+	for _, p := range paths {
+		if got := statusOf(disabled, p); got != http.StatusNotFound {
+			t.Errorf("disabled: %s = %d, want 404", p, got)
+		}
+	}
+}
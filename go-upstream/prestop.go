@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const removalPollInterval = 500 * time.Millisecond
+
+// prestopIdlePoll is how often /prestop checks the in-flight count while
+// waiting for traffic to drain.
+const prestopIdlePoll = 20 * time.Millisecond
+
+// EndpointRemovalWaiter blocks until the control plane confirms this pod
+// is out of the Service endpoints, so /prestop can return as soon as that
+// is true instead of sleeping a fixed PRESTOP_DELAY.
+type EndpointRemovalWaiter interface {
+	WaitRemoved(ctx context.Context) error
+}
+
+// NoopRemovalWaiter reports removal immediately, for setups where
+// something else already guarantees no traffic arrives.
+type NoopRemovalWaiter struct{}
+
+func (NoopRemovalWaiter) WaitRemoved(context.Context) error { return nil }
+
+// HTTPRemovalWaiter polls URL until it answers 2xx, which it should do
+// once the pod has been removed from the endpoint set. It is a stub for a
+// mesh control-plane query; the URL is expected to identify the pod.
+type HTTPRemovalWaiter struct {
+	URL      string
+	Interval time.Duration
+	Client   *http.Client
+}
+
+func (w *HTTPRemovalWaiter) WaitRemoved(ctx context.Context) error {
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.URL, nil)
+		if err != nil {
+			return err
+		}
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitIdle blocks until no request other than the caller's own is in
+// flight, or ctx is done.
+func (a *app) waitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(prestopIdlePoll)
+	defer ticker.Stop()
+	for a.inFlight.Load() > 1 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// handlePrestop holds the preStop hook open while K8s removes the pod from
+// the Service endpoints: until the removal waiter confirms it or, when none
+// is configured, until the requests in flight besides this one have
+// finished. Without a waiter the hook therefore returns as soon as the
+// server is idle, which may be well before PRESTOP_DELAY, rather than
+// always sleeping for it. PRESTOP_DELAY caps the wait, and is itself capped
+// at PRESTOP_MAX_DELAY so a misconfigured delay can't keep the hook running
+// until the pod is SIGKILLed. The hook returns early if the kubelet
+// cancels it.
+func (a *app) handlePrestop(c *gin.Context) {
+	delay := a.cfg.PrestopDelay
+	requestLog(c).Info("preStop hook called — starting graceful drain", "event", "prestop_started", "delay", delay.String())
+	if limit := a.cfg.PrestopMaxDelay; limit > 0 && delay > limit {
+		requestLog(c).Warn("PRESTOP_DELAY exceeds PRESTOP_MAX_DELAY — returning early", "event", "prestop_capped", "delay", delay.String(), "max_delay", limit.String())
+		delay = limit
+	}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), delay)
+	defer cancel()
+
+	var err error
+	if a.removalWaiter == nil {
+		err = a.waitIdle(ctx)
+	} else {
+		err = a.removalWaiter.WaitRemoved(ctx)
+	}
+	waitedMs := time.Since(start).Milliseconds()
+	// Don't count this hook itself
+	inFlight := a.inFlight.Load() - 1
+	if cause := c.Request.Context().Err(); cause != nil {
+		requestLog(c).Warn("preStop hook cancelled — returning early", "event", "prestop_cancelled", "elapsed_ms", waitedMs, "error", cause)
+		abortWithError(c, statusClientClosedRequest, codeCancelled, "prestop cancelled")
+		return
+	}
+	if a.removalWaiter == nil {
+		if err != nil {
+			requestLog(c).Warn("requests still in flight at PRESTOP_DELAY — continuing", "event", "prestop_delay_elapsed", "elapsed_ms", waitedMs, "in_flight", inFlight)
+		} else {
+			requestLog(c).Info("in-flight requests drained — ready for SIGTERM", "event", "prestop_complete", "elapsed_ms", waitedMs)
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "drained", "waited_ms": waitedMs, "in_flight": inFlight})
+		return
+	}
+	if err != nil {
+		requestLog(c).Warn("endpoint removal not acknowledged — continuing", "event", "prestop_removal_unconfirmed", "elapsed_ms", waitedMs, "error", err)
+		c.JSON(http.StatusOK, gin.H{"status": "drained", "removal": "unconfirmed", "waited_ms": waitedMs, "in_flight": inFlight})
+		return
+	}
+	requestLog(c).Info("endpoint removal acknowledged — ready for SIGTERM", "event", "prestop_complete", "elapsed_ms", waitedMs)
+	c.JSON(http.StatusOK, gin.H{"status": "drained", "removal": "acknowledged", "waited_ms": waitedMs, "in_flight": inFlight})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRemovalWaiter acknowledges removal after delay.
+type fakeRemovalWaiter struct {
+	delay time.Duration
+}
+
+func (w fakeRemovalWaiter) WaitRemoved(ctx context.Context) error {
+	select {
+	case <-time.After(w.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// holdRequest keeps one request in flight on r until the returned func is
+// called.
+func holdRequest(r *gin.Engine) (release func()) {
+	done := make(chan struct{})
+	started := make(chan struct{})
+	r.GET("/held", func(c *gin.Context) {
+		close(started)
+		<-done
+	})
+	go r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/held", nil))
+	<-started
+	return func() { close(done) }
+}
+
+func TestPrestopReturnsOnceRemovalIsAcknowledged(t *testing.T) {
+	a := newApp(defaultConfig())
+	a.removalWaiter = fakeRemovalWaiter{delay: 50 * time.Millisecond}
+	r := newRouter(a)
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prestop", nil))
+	elapsed := time.Since(start)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("prestop took %s, want about the 50ms removal delay, not the 5s PRESTOP_DELAY", elapsed)
+	}
+	var body struct{ Removal string }
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Removal != "acknowledged" {
+		t.Errorf("removal = %q, want acknowledged", body.Removal)
+	}
+}
+
+func TestPrestopDelayCapsRemovalWait(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.PrestopDelay = 50 * time.Millisecond
+	a := newApp(cfg)
+	a.removalWaiter = fakeRemovalWaiter{delay: time.Hour}
+	r := newRouter(a)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prestop", nil))
+	var body struct{ Removal string }
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Removal != "unconfirmed" {
+		t.Errorf("removal = %q, want unconfirmed after PRESTOP_DELAY", body.Removal)
+	}
+}
+
+func TestHTTPRemovalWaiterPollsUntil2xx(t *testing.T) {
+	var polls atomic.Int32
+	control := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if polls.Add(1) < 3 {
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer control.Close()
+
+	w := &HTTPRemovalWaiter{URL: control.URL, Interval: 10 * time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := w.WaitRemoved(ctx); err != nil {
+		t.Fatalf("WaitRemoved: %v", err)
+	}
+	if n := polls.Load(); n != 3 {
+		t.Errorf("polls = %d, want 3", n)
+	}
+}
+
+func TestPrestopReturnsEarlyWhenCancelled(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := defaultConfig()
+	cfg.PrestopDelay = time.Hour
+	cfg.PrestopMaxDelay = 0
+	r := newRouter(newApp(cfg))
+	// An in-flight request keeps prestop waiting until it is cancelled
+	defer holdRequest(r)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prestop", nil).WithContext(ctx))
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("prestop took %s after cancellation, want an early return", elapsed)
+	}
+	assertErrorEnvelope(t, w, codeCancelled)
+	waitForLog(t, logs, "prestop_cancelled")
+}
+
+func TestPrestopMaxDelayCapsSleep(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := defaultConfig()
+	cfg.PrestopDelay = time.Hour
+	cfg.PrestopMaxDelay = 50 * time.Millisecond
+	r := newRouter(newApp(cfg))
+	defer holdRequest(r)()
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prestop", nil))
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("prestop took %s, want about the 50ms PRESTOP_MAX_DELAY", elapsed)
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+	waitForLog(t, logs, "prestop_capped")
+}
+
+func TestPrestopWaitsForInFlightRequests(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.PrestopDelay = 5 * time.Second
+	r := newRouter(newApp(cfg))
+	time.AfterFunc(100*time.Millisecond, holdRequest(r))
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prestop", nil))
+	elapsed := time.Since(start)
+
+	if elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("prestop took %s, want about the 100ms the other request needed", elapsed)
+	}
+	var body struct {
+		WaitedMs int64 `json:"waited_ms"`
+		InFlight int64 `json:"in_flight"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.InFlight != 0 || body.WaitedMs < 100 {
+		t.Errorf("body = %s, want in_flight 0 and waited_ms >= 100", w.Body.String())
+	}
+}
+
+func TestPrestopReportsRequestsLeftAtDelay(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.PrestopDelay = 100 * time.Millisecond
+	r := newRouter(newApp(cfg))
+	defer holdRequest(r)()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prestop", nil))
+
+	var body struct {
+		WaitedMs int64 `json:"waited_ms"`
+		InFlight int64 `json:"in_flight"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.InFlight != 1 || body.WaitedMs < 100 {
+		t.Errorf("body = %s, want in_flight 1 after waiting the 100ms PRESTOP_DELAY", w.Body.String())
+	}
+}
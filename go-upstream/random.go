@@ -0,0 +1,58 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// randSource hands out random numbers from generators seeded per process,
+// so pods started from the same image don't share a latency or error
+// sequence. A rand.Rand isn't safe for concurrent use, so each caller
+// borrows one from a pool instead of contending on a single lock.
+type randSource struct {
+	seed int64
+	n    atomic.Int64
+	pool sync.Pool
+}
+
+func newRandSource(seed int64) *randSource {
+	s := &randSource{seed: seed}
+	s.pool.New = func() any {
+		// Every pooled generator gets its own stream derived from seed
+		return rand.New(rand.NewSource(s.seed ^ s.n.Add(1)*0x5DEECE66D))
+	}
+	return s
+}
+
+// processSeed mixes the start time with the hostname and PID, so two pods
+// that start in the same nanosecond still diverge.
+func processSeed() int64 {
+	h := fnv.New64a()
+	host, _ := os.Hostname()
+	h.Write([]byte(host))
+	h.Write([]byte(strconv.Itoa(os.Getpid())))
+	return time.Now().UnixNano() ^ int64(h.Sum64())
+}
+
+func (s *randSource) with(fn func(r *rand.Rand)) {
+	r := s.pool.Get().(*rand.Rand)
+	fn(r)
+	s.pool.Put(r)
+}
+
+// Intn returns a number in [0, n).
+func (s *randSource) Intn(n int) (v int) {
+	s.with(func(r *rand.Rand) { v = r.Intn(n) })
+	return v
+}
+
+// Float64 returns a number in [0.0, 1.0).
+func (s *randSource) Float64() (v float64) {
+	s.with(func(r *rand.Rand) { v = r.Float64() })
+	return v
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestIndependentSeedsDiverge(t *testing.T) {
+	a, b := newRandSource(1), newRandSource(2)
+	same := 0
+	for i := 0; i < 100; i++ {
+		if a.Intn(1000) == b.Intn(1000) {
+			same++
+		}
+	}
+	// Two independent uniform streams over 1000 values collide ~0.1 times
+	// in 100 draws
+	if same > 5 {
+		t.Errorf("%d of 100 draws matched, want independent sequences", same)
+	}
+}
+
+func TestRandSourceConcurrentUse(t *testing.T) {
+	s := newRandSource(processSeed())
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if v := s.Float64(); v < 0 || v >= 1 {
+					t.Errorf("Float64 = %v, want [0, 1)", v)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
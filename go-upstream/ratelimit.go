@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTTL is how long a client's limiter is kept after its last
+// request. A client returning after that starts with a full bucket, which
+// is what an idle limiter would hold anyway.
+const limiterIdleTTL = 3 * time.Minute
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipLimiters hands out one token bucket per client IP and evicts the ones
+// that have gone idle, so memory is bounded by recently active clients.
+type ipLimiters struct {
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	rps       rate.Limit
+	burst     int
+	lastSweep time.Time
+}
+
+func (l *ipLimiters) get(ip string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > limiterIdleTTL {
+		for k, c := range l.clients {
+			if now.Sub(c.lastSeen) > limiterIdleTTL {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.clients[ip] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+// rateLimit allows each client IP rps requests per second with bursts of
+// up to burst. Over-limit requests get 429 and a Retry-After. Probes and
+// metrics are exempt. rps <= 0 disables the limit.
+func rateLimit(rps float64, burst int) gin.HandlerFunc {
+	if rps <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	limiters := &ipLimiters{clients: map[string]*clientLimiter{}, rps: rate.Limit(rps), burst: burst, lastSweep: time.Now()}
+	retryAfter := strconv.Itoa(int(math.Max(1, math.Ceil(1/rps))))
+
+	return func(c *gin.Context) {
+		if operationalRoute(c.FullPath()) {
+			c.Next()
+			return
+		}
+		if !limiters.get(c.ClientIP(), time.Now()).Allow() {
+			c.Header("Retry-After", retryAfter)
+			abortWithError(c, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitPerClientIP(t *testing.T) {
+	r := gin.New()
+	r.Use(rateLimit(1, 3))
+	r.GET("/work", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(path, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	var limited int
+	for i := 0; i < 10; i++ {
+		w := get("/work", "10.0.0.1")
+		if w.Code == http.StatusTooManyRequests {
+			limited++
+			if w.Header().Get("Retry-After") != "1" {
+				t.Errorf("Retry-After = %q, want 1", w.Header().Get("Retry-After"))
+			}
+			continue
+		}
+		if i >= 3 {
+			t.Errorf("request %d = %d after the burst of 3 was spent, want 429", i+1, w.Code)
+		}
+	}
+	if limited != 7 {
+		t.Errorf("limited = %d, want 7", limited)
+	}
+
+	if w := get("/work", "10.0.0.2"); w.Code != http.StatusOK {
+		t.Errorf("another client = %d, want 200", w.Code)
+	}
+	if w := get("/health", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Errorf("/health for a limited client = %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.RateLimitRPS, cfg.RateLimitBurst = 1, 1
+	r := newRouter(newApp(cfg))
+
+	var limited int
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/version", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	if limited != 4 {
+		t.Errorf("limited = %d of 5 requests with rotating X-Forwarded-For, want 4", limited)
+	}
+}
+
+func TestIPLimitersEvictIdleClients(t *testing.T) {
+	l := &ipLimiters{clients: map[string]*clientLimiter{}, rps: 1, burst: 1}
+	start := time.Now()
+	l.get("10.0.0.1", start)
+	l.get("10.0.0.2", start.Add(limiterIdleTTL))
+	l.get("10.0.0.2", start.Add(limiterIdleTTL+2*time.Second))
+
+	if _, ok := l.clients["10.0.0.1"]; ok {
+		t.Error("idle client was not evicted")
+	}
+	if _, ok := l.clients["10.0.0.2"]; !ok {
+		t.Error("active client was evicted")
+	}
+}
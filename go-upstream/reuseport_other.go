@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "syscall"
+
+const reusePortSupported = false
+
+var reusePortControl func(network, address string, c syscall.RawConn) error
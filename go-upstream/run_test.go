@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startRun runs the server from cfg on a free port the way main does and
+// returns its base URL and the channel run's result arrives on.
+func startRun(t *testing.T, ctx context.Context, cfg Config) (string, <-chan error) {
+	t.Helper()
+	cfg.Addr = freeAddr(t)
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, cfg) }()
+	base := "http://" + cfg.Addr
+	waitForServer(t, base+"/health")
+	return base, done
+}
+
+func TestRunDrainsInFlightAndRefusesNewRequestsOnSIGTERM(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := shutdownTestConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 500, 500
+	base, done := startRun(t, context.Background(), cfg)
+
+	slow := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(base + "/api/data")
+		if err != nil {
+			slow <- 0
+			return
+		}
+		resp.Body.Close()
+		slow <- resp.StatusCode
+	}()
+	waitForInFlight(t, base, 1)
+
+	// Signal only this process: the go tool shares the process group
+	sendSignal(t, syscall.SIGTERM)
+	waitForLog(t, logs, "shutdown_phase")
+
+	// A fresh connection is either refused outright or turned away with 503
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: 2 * time.Second}
+	if resp, err := client.Get(base + "/api/data"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("request after SIGTERM = %d, want it refused", resp.StatusCode)
+		}
+	}
+
+	if code := <-slow; code != http.StatusOK {
+		t.Errorf("in-flight request = %d, want 200", code)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after the drain")
+	}
+}
+
+// waitForInFlight polls /debug/inflight until it reports want requests.
+func waitForInFlight(t *testing.T, base string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if resp, err := http.Get(base + "/debug/inflight"); err == nil {
+			var body struct {
+				InFlight int `json:"in_flight"`
+			}
+			json.NewDecoder(resp.Body).Decode(&body)
+			resp.Body.Close()
+			if body.InFlight == want {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("in-flight count never reached %d", want)
+}
+
+func TestRunShutsDownWhenContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	_, done := startRun(t, ctx, shutdownTestConfig())
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after ctx was cancelled")
+	}
+}
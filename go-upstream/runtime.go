@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+const defaultRuntimeSampleInterval = 10 * time.Second
+
+// runtimeSample is a point-in-time view of the Go runtime, enough to spot
+// goroutines or memory that a drain fails to release.
+type runtimeSample struct {
+	goroutines int
+	heapAlloc  uint64
+	sys        uint64
+}
+
+func sampleRuntime() runtimeSample {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return runtimeSample{goroutines: runtime.NumGoroutine(), heapAlloc: ms.HeapAlloc, sys: ms.Sys}
+}
+
+// sampleRuntimeJob is the background job behind the sampled_* gauges.
+func (a *app) sampleRuntimeJob(context.Context) {
+	a.metrics.recordRuntime(sampleRuntime())
+}
+
+// logRuntime logs a fresh sample under event, so the values at the start
+// and end of the drain can be compared.
+func logRuntime(event string) {
+	s := sampleRuntime()
+	slog.Info("runtime sample", "event", event, "goroutines", s.goroutines, "heap_alloc_bytes", s.heapAlloc, "sys_bytes", s.sys)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	selfCheckInterval = 5 * time.Second
+	selfCheckTimeout  = time.Second
+)
+
+// listenerCheck records whether the server's own listener still accepts
+// connections. A process can keep running with its listener closed or
+// wedged; the heartbeat wouldn't notice, but this makes /health fail so
+// the pod gets restarted.
+type listenerCheck struct {
+	mu      sync.Mutex
+	lastErr error
+}
+
+func (l *listenerCheck) set(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastErr = err
+}
+
+func (l *listenerCheck) get() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastErr
+}
+
+// startSelfCheck dials addr every interval and registers the result as
+// the "listener" health check. With TLS configured each dial completes a
+// handshake, since a bare connect-and-close makes the server log a
+// handshake error every time. Dials are skipped once shutdown starts,
+// since the listener closing then is expected.
+func (a *app) startSelfCheck(addr net.Addr, interval time.Duration) (stop func()) {
+	a.health.Register("listener", func(context.Context) error {
+		if a.shuttingDown.Load() {
+			return nil
+		}
+		return a.listenerCheck.get()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go runTicker(ctx, interval, func(ctx context.Context) {
+		if a.shuttingDown.Load() {
+			return
+		}
+		conn, err := a.dialSelf(ctx, addr)
+		if err != nil {
+			// A dial cut short by stop says nothing about the listener
+			if ctx.Err() == nil {
+				a.listenerCheck.set(err)
+			}
+			return
+		}
+		conn.Close()
+		a.listenerCheck.set(nil)
+	})
+	return cancel
+}
+
+// dialSelf connects to addr within selfCheckTimeout, completing a TLS
+// handshake when the server serves TLS.
+func (a *app) dialSelf(ctx context.Context, addr net.Addr) (net.Conn, error) {
+	d := &net.Dialer{Timeout: selfCheckTimeout}
+	if a.cfg.TLSCertFile == "" {
+		return d.DialContext(ctx, addr.Network(), addr.String())
+	}
+	// Only reachability is checked, so the certificate isn't verified
+	td := &tls.Dialer{NetDialer: d, Config: &tls.Config{InsecureSkipVerify: true}}
+	return td.DialContext(ctx, addr.Network(), addr.String())
+}
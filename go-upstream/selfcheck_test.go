@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelfCheckFailsHealthWhenListenerCloses(t *testing.T) {
+	a := newApp(defaultConfig())
+	r := newRouter(a)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: r}
+	go srv.Serve(l)
+	defer srv.Close()
+	defer a.startSelfCheck(l.Addr(), 10*time.Millisecond)()
+
+	waitForHealth := func(want int) healthBody {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			code, body := getHealth(t, r)
+			if code == want {
+				return body
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("/health = %d %+v, want %d", code, body, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitForHealth(http.StatusOK)
+	l.Close()
+	body := waitForHealth(http.StatusServiceUnavailable)
+	if len(body.Failing) != 1 || body.Failing[0] != "listener" {
+		t.Errorf("failing = %v, want [listener]", body.Failing)
+	}
+
+	// Once shutdown starts a closed listener is expected, not a failure
+	a.shuttingDown.Store(true)
+	waitForHealth(http.StatusOK)
+}
+
+func TestSelfCheckCompletesTLSHandshake(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := defaultConfig()
+	cfg.TLSCertFile, cfg.TLSKeyFile = writeSelfSignedCert(t)
+	a := newApp(cfg)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := newHTTPServer(cfg, newRouter(a))
+	go a.serve(srv, l)
+	defer srv.Close()
+
+	stop := a.startSelfCheck(l.Addr(), 10*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	stop()
+	if err := a.listenerCheck.get(); err != nil {
+		t.Errorf("listener check = %v, want nil", err)
+	}
+	if strings.Contains(logs.String(), "TLS handshake error") {
+		t.Errorf("self-check dials caused handshake errors:\n%s", logs)
+	}
+
+	// A client that hangs up mid-handshake is still logged, as JSON
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Close()
+	waitForLog(t, logs, "http_server_error")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// runShutdownPhases takes the server down in order, logging each phase
+// with its timing:
+//
+//  1. readiness: /ready starts failing
+//  2. lame_duck: requests are still served for LAMEDUCK_DELAY while
+//     endpoint removal propagates, then new ones are turned away
+//  3. keep-alives: responses carry Connection: close
+//  4. websockets: /ws clients get a close frame and up to a quarter of
+//     SHUTDOWN_TIMEOUT (at most 5s) to disconnect before they are closed
+//  5. http_drain: srv.Shutdown waits for in-flight requests; long polls
+//     were already released with 204 when the lame-duck window ended
+//  6. resources: the ShutdownManager hooks close clients and exporters,
+//     then the registered Flushers write out buffered logs and metrics
+//
+// Resources only close once HTTP has drained, so no request still running
+// finds its dependencies gone. All phases share ctx as their budget.
+func (a *app) runShutdownPhases(ctx context.Context, srv *http.Server) error {
+	phase := func(name string, fn func() error) error {
+		start := time.Now()
+		err := fn()
+		slog.Info("shutdown phase complete", "event", "shutdown_phase", "phase", name, "elapsed_ms", time.Since(start).Milliseconds(), "error", err)
+		return err
+	}
+
+	phase("readiness", func() error {
+		markNow(&a.lifecycleTimes.draining)
+		a.lameDuck.Store(a.cfg.LameDuckDelay > 0)
+		a.shuttingDown.Store(true)
+		return nil
+	})
+	// Endpoint removal is eventually consistent, so clients that haven't
+	// seen /ready fail yet keep getting normal responses for a while
+	phase("lame_duck", func() error {
+		defer close(a.drainBegun)
+		defer a.checkDrained()
+		defer a.lameDuck.Store(false)
+		if a.cfg.LameDuckDelay <= 0 {
+			return nil
+		}
+		slog.Info("lame-duck window started", "event", "lameduck_started", "delay_ms", a.cfg.LameDuckDelay.Milliseconds())
+		timer := time.NewTimer(a.cfg.LameDuckDelay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		slog.Info("lame-duck window ended", "event", "lameduck_complete", "in_flight", a.inFlight.Load())
+		return nil
+	})
+	// Clients holding keep-alive connections reconnect to another pod
+	// instead of pipelining more requests onto this one
+	phase("keep_alives", func() error {
+		srv.SetKeepAlivesEnabled(false)
+		return nil
+	})
+	// srv.Shutdown ignores hijacked connections, so close them first.
+	// Clients that outlast their share are closed without failing the
+	// shutdown; only running out of the whole budget counts.
+	wsErr := phase("websockets", func() error {
+		wsCtx, cancel := context.WithTimeout(ctx, wsCloseBudget(a.cfg.ShutdownTimeout))
+		defer cancel()
+		a.websockets.closeAll(wsCtx)
+		return ctx.Err()
+	})
+	httpErr := phase("http_drain", func() error {
+		if err := srv.Shutdown(ctx); err != nil || !a.cfg.EnableH2C {
+			return err
+		}
+		// h2c connections are hijacked, so Shutdown only sent them GOAWAY
+		select {
+		case <-a.drained:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if errors.Is(httpErr, context.DeadlineExceeded) {
+		reqs := a.activeRequests()
+		slog.Error("shutdown timed out with requests still in flight", "event", "shutdown_timeout",
+			"timeout_ms", a.cfg.ShutdownTimeout.Milliseconds(), "in_flight", len(reqs), "requests", reqs)
+	}
+	resourcesErr := phase("resources", func() error {
+		return a.shutdown.RunShutdown(ctx)
+	})
+	return errors.Join(wsErr, httpErr, resourcesErr)
+}
+
+// ShutdownManager collects cleanup hooks for the parts of the process that
+// need stopping after the HTTP drain (background workers, clients) and
+// runs them in reverse registration order, so things started last stop first.
+type ShutdownManager struct {
+	mu    sync.Mutex
+	hooks []func(context.Context) error
+}
+
+// Register adds a hook to run on shutdown.
+func (m *ShutdownManager) Register(hook func(context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// RunShutdown invokes every registered hook in LIFO order, sharing ctx as the
+// overall budget. A failing hook is logged and does not stop the remaining
+// ones; all errors are returned joined.
+func (m *ShutdownManager) RunShutdown(ctx context.Context) error {
+	m.mu.Lock()
+	hooks := make([]func(context.Context) error, len(m.hooks))
+	copy(hooks, m.hooks)
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		start := time.Now()
+		if err := hooks[i](ctx); err != nil {
+			slog.Error("shutdown hook failed", "event", "shutdown_hook_failed", "hook", i, "elapsed_ms", time.Since(start).Milliseconds(), "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		slog.Debug("shutdown hook done", "event", "shutdown_hook_done", "hook", i, "elapsed_ms", time.Since(start).Milliseconds())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestShutdownManagerRunsHooksInReverseOrder(t *testing.T) {
+	var m ShutdownManager
+	var order []string
+	m.Register(func(ctx context.Context) error {
+		order = append(order, "first")
+		return nil
+	})
+	m.Register(func(ctx context.Context) error {
+		order = append(order, "second")
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := m.RunShutdown(ctx); err != nil {
+		t.Fatalf("RunShutdown: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("hooks exceeded the timeout budget")
+	}
+	if len(order) != 2 || order[0] != "second" || order[1] != "first" {
+		t.Errorf("order = %v, want [second first]", order)
+	}
+}
+
+func TestShutdownManagerContinuesAfterHookError(t *testing.T) {
+	var m ShutdownManager
+	ran := false
+	m.Register(func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	boom := errors.New("boom")
+	m.Register(func(ctx context.Context) error { return boom })
+
+	err := m.RunShutdown(context.Background())
+	if !errors.Is(err, boom) {
+		t.Errorf("RunShutdown = %v, want it to wrap %v", err, boom)
+	}
+	if !ran {
+		t.Error("hook after the failing one did not run")
+	}
+}
+
+// fakeResource records when it was closed relative to the HTTP drain.
+type fakeResource struct {
+	name   string
+	closed *[]string
+	served *atomic.Bool
+	early  *atomic.Bool
+}
+
+func (r fakeResource) Close(context.Context) error {
+	if !r.served.Load() {
+		r.early.Store(true)
+	}
+	*r.closed = append(*r.closed, r.name)
+	return nil
+}
+
+func TestShutdownPhasesCloseResourcesAfterHTTPDrain(t *testing.T) {
+	logs := captureLogs(t)
+	a := newApp(shutdownTestConfig())
+	r := newRouter(a)
+
+	var served, early atomic.Bool
+	var closed []string
+	for _, name := range []string{"db", "cache"} {
+		a.shutdown.Register(fakeResource{name: name, closed: &closed, served: &served, early: &early}.Close)
+	}
+
+	started := make(chan struct{})
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		served.Store(true)
+		c.Status(http.StatusOK)
+	})
+
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: r}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+	go func() {
+		if resp, err := http.Get("http://" + addr + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	sendSignal(t, syscall.SIGTERM)
+	if err := <-done; err != nil {
+		t.Fatalf("serveGraceful: %v", err)
+	}
+
+	if early.Load() {
+		t.Error("a resource was closed while a request was still in flight")
+	}
+	if len(closed) != 2 || closed[0] != "cache" || closed[1] != "db" {
+		t.Errorf("closed = %v, want [cache db]", closed)
+	}
+
+	var phases []string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, `"event":"shutdown_phase"`) {
+			var entry struct{ Phase string }
+			json.Unmarshal([]byte(line), &entry)
+			phases = append(phases, entry.Phase)
+		}
+	}
+	if want := []string{"readiness", "lame_duck", "keep_alives", "websockets", "http_drain", "resources"}; strings.Join(phases, ",") != strings.Join(want, ",") {
+		t.Errorf("phases = %v, want %v", phases, want)
+	}
+}
+
+func TestLameDuckKeepsServingAfterReadinessFails(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := shutdownTestConfig()
+	cfg.LameDuckDelay = 300 * time.Millisecond
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	a := newApp(cfg)
+	r := newRouter(a)
+
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: r}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+
+	sendSignal(t, syscall.SIGTERM)
+	waitForLog(t, logs, "lameduck_started")
+
+	if got := statusOf(r, "/ready"); got != http.StatusServiceUnavailable {
+		t.Errorf("/ready during lame duck = %d, want 503", got)
+	}
+	resp, err := http.Get("http://" + addr + "/api/data")
+	if err != nil {
+		t.Fatalf("GET /api/data during lame duck: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/api/data during lame duck = %d, want 200", resp.StatusCode)
+	}
+
+	waitForLog(t, logs, "lameduck_complete")
+	if got := statusOf(r, "/api/data"); got != http.StatusServiceUnavailable {
+		t.Errorf("/api/data after lame duck = %d, want 503", got)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("serveGraceful: %v", err)
+	}
+}
+
+// countingFlusher records how often it was flushed and what ran before.
+type countingFlusher struct {
+	flushes atomic.Int64
+	hookRan *atomic.Bool
+	late    atomic.Bool
+}
+
+func (f *countingFlusher) Flush(ctx context.Context) error {
+	f.flushes.Add(1)
+	if !f.hookRan.Load() {
+		f.late.Store(true)
+	}
+	return nil
+}
+
+// bufferedFlusher writes out its pending data unless ctx is already done.
+type bufferedFlusher struct {
+	pending, out bytes.Buffer
+}
+
+func (f *bufferedFlusher) Flush(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := f.pending.WriteTo(&f.out)
+	return err
+}
+
+func TestFlushRunsAfterShutdownTimeout(t *testing.T) {
+	a := newApp(shutdownTestConfig())
+	f := &bufferedFlusher{}
+	f.pending.WriteString("last log line\n")
+	a.RegisterFlusher("buffer", f)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.flush(ctx); err != nil {
+		t.Fatalf("flush with a cancelled context: %v", err)
+	}
+	if got := f.out.String(); got != "last log line\n" {
+		t.Errorf("flushed %q, want the pending line", got)
+	}
+}
+
+func TestShutdownFlushesOnceAfterOtherHooks(t *testing.T) {
+	a := newApp(shutdownTestConfig())
+	var hookRan atomic.Bool
+	f := &countingFlusher{hookRan: &hookRan}
+	a.RegisterFlusher("fake", f)
+	a.shutdown.Register(func(context.Context) error {
+		hookRan.Store(true)
+		return nil
+	})
+
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: newRouter(a)}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+	if n := f.flushes.Load(); n != 0 {
+		t.Fatalf("flushed %d times before shutdown", n)
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+	if err := <-done; err != nil {
+		t.Fatalf("serveGraceful: %v", err)
+	}
+	if n := f.flushes.Load(); n != 1 {
+		t.Errorf("flushed %d times, want exactly once", n)
+	}
+	if f.late.Load() {
+		t.Error("flush ran before a hook registered after it")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"syscall"
+	"testing"
+)
+
+// sendSignal skips the test: a process can't signal itself here.
+func sendSignal(t *testing.T, sig syscall.Signal) {
+	t.Helper()
+	t.Skipf("sending %v to the test process needs a unix platform", sig)
+}
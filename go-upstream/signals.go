@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+const defaultShutdownSignals = "SIGTERM,SIGINT"
+
+// parseSignals resolves a comma-separated SHUTDOWN_SIGNALS list such as
+// "SIGTERM,SIGINT". Names are case-insensitive and the SIG prefix is
+// optional. Names this platform doesn't know are returned in unknown
+// rather than failing, so a typo doesn't keep the pod from starting.
+func parseSignals(raw string) (sigs []os.Signal, unknown []string) {
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !strings.HasPrefix(name, "SIG") {
+			name = "SIG" + name
+		}
+		sig, ok := signalsByName[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, unknown
+}
+
+// shutdownSignals returns the signals that start a graceful shutdown,
+// falling back to the defaults when SHUTDOWN_SIGNALS names none that are
+// valid; signal.Notify with no signals would catch every signal.
+func (c Config) shutdownSignals() []os.Signal {
+	sigs, _ := parseSignals(c.ShutdownSignals)
+	if len(sigs) == 0 {
+		sigs, _ = parseSignals(defaultShutdownSignals)
+	}
+	return sigs
+}
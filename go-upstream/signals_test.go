@@ -0,0 +1,59 @@
+//go:build unix
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseSignals(t *testing.T) {
+	sigs, unknown := parseSignals(" sigterm, USR1,SIGBOGUS,,SIGQUIT")
+	if want := []os.Signal{syscall.SIGTERM, syscall.SIGUSR1}; !reflect.DeepEqual(sigs, want) {
+		t.Errorf("signals = %v, want %v", sigs, want)
+	}
+	if want := []string{"SIGBOGUS", "SIGQUIT"}; !reflect.DeepEqual(unknown, want) {
+		t.Errorf("unknown = %v, want %v", unknown, want)
+	}
+}
+
+func TestShutdownSignalsFallBackToDefaults(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.ShutdownSignals = "SIGNOPE"
+	if got, want := cfg.shutdownSignals(), []os.Signal{syscall.SIGTERM, syscall.SIGINT}; !reflect.DeepEqual(got, want) {
+		t.Errorf("shutdownSignals() = %v, want %v", got, want)
+	}
+	if w := cfg.warnings(); len(w) != 2 {
+		t.Errorf("warnings() = %v, want an unknown-signal and a fallback warning", w)
+	}
+}
+
+func TestConfiguredSignalStartsShutdown(t *testing.T) {
+	cfg := shutdownTestConfig()
+	cfg.ShutdownSignals = "SIGUSR1"
+	a := newApp(cfg)
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: newRouter(a)}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatalf("kill: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveGraceful: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGUSR1 did not start a graceful shutdown")
+	}
+	if !a.shuttingDown.Load() {
+		t.Error("shuttingDown not set after SIGUSR1")
+	}
+}
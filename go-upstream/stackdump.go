@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+)
+
+// dumpStacksOnSIGQUIT writes a full goroutine dump to w on every SIGQUIT
+// instead of letting the runtime dump and exit, so a hung drain can be
+// inspected without killing the process. Call the returned func to stop.
+func dumpStacksOnSIGQUIT(w io.Writer) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGQUIT)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				stack := allStacks()
+				w.Write(stack)
+				slog.Info("goroutine dump written", "event", "stack_dump", "goroutines", runtime.NumGoroutine(), "bytes", len(stack))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// allStacks returns the stacks of every goroutine, growing the buffer until
+// the dump fits.
+func allStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
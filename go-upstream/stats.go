@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statsReservoirSize bounds the latency samples /stats keeps. Once full,
+// the oldest sample is overwritten, so the percentiles describe recent
+// traffic, which is what matters when watching a drain.
+const statsReservoirSize = 4096
+
+// latencyStats keeps a ring of recent request latencies for /stats. It is
+// a quick local view; Prometheus histograms remain the real source.
+type latencyStats struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	count   uint64
+}
+
+func (s *latencyStats) record(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	if len(s.samples) < statsReservoirSize {
+		s.samples = append(s.samples, d)
+		return
+	}
+	s.samples[s.next] = d
+	s.next = (s.next + 1) % statsReservoirSize
+}
+
+func (s *latencyStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples, s.next, s.count = nil, 0, 0
+}
+
+// snapshot returns the request count and the p50/p95/p99 latencies in
+// milliseconds, by nearest rank over the reservoir.
+func (s *latencyStats) snapshot() gin.H {
+	s.mu.Lock()
+	sorted := append([]time.Duration(nil), s.samples...)
+	count := s.count
+	s.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) float64 {
+		if len(sorted) == 0 {
+			return 0
+		}
+		rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		return float64(sorted[max(rank, 0)].Microseconds()) / 1000
+	}
+	return gin.H{
+		"requests": count,
+		"samples":  len(sorted),
+		"latency_ms": gin.H{
+			"p50": percentile(50),
+			"p95": percentile(95),
+			"p99": percentile(99),
+		},
+	}
+}
+
+// handleStats reports the latency percentiles; ?reset=true clears them
+// after reporting, to measure one phase of a test at a time.
+func (a *app) handleStats(c *gin.Context) {
+	stats := a.metrics.latencies.snapshot()
+	if c.Query("reset") == "true" {
+		a.metrics.latencies.reset()
+	}
+	c.JSON(http.StatusOK, stats)
+}
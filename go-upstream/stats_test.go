@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type statsBody struct {
+	Requests  int `json:"requests"`
+	LatencyMs struct {
+		P50, P95, P99 float64
+	} `json:"latency_ms"`
+}
+
+func getStats(t *testing.T, r http.Handler, path string) statsBody {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var body statsBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+func TestLatencyStatsPercentiles(t *testing.T) {
+	var s latencyStats
+	for ms := 100; ms >= 1; ms-- {
+		s.record(time.Duration(ms) * time.Millisecond)
+	}
+	got := s.snapshot()["latency_ms"].(gin.H)
+	want := map[string]float64{"p50": 50, "p95": 95, "p99": 99}
+	for k, v := range want {
+		if p := got[k]; p != v {
+			t.Errorf("%s = %v, want %v", k, p, v)
+		}
+	}
+}
+
+func TestStatsEndpointReportsAndResets(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 20, 20
+	r := newRouter(newApp(cfg))
+	for i := 0; i < 5; i++ {
+		statusOf(r, "/api/data")
+	}
+	statusOf(r, "/health")
+
+	stats := getStats(t, r, "/stats?reset=true")
+	if stats.Requests != 5 {
+		t.Errorf("requests = %d, want 5 (probes excluded)", stats.Requests)
+	}
+	for name, p := range map[string]float64{"p50": stats.LatencyMs.P50, "p95": stats.LatencyMs.P95, "p99": stats.LatencyMs.P99} {
+		if p < 20 || p > 200 {
+			t.Errorf("%s = %vms, want near the 20ms simulated latency", name, p)
+		}
+	}
+	if after := getStats(t, r, "/stats"); after.Requests != 0 || after.LatencyMs.P99 != 0 {
+		t.Errorf("after reset = %+v, want empty", after)
+	}
+}
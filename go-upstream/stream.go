@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	streamChunks        = 10
+	streamChunkInterval = 300 * time.Millisecond
+)
+
+// handleStream writes streamChunks NDJSON lines over a few seconds. Unlike
+// /events it counts as in flight, so it shows what happens to a long
+// response when the drain starts: the stream stops early and ends with an
+// error line instead of being silently truncated.
+func (a *app) handleStream(c *gin.Context) {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(streamChunkInterval)
+	defer ticker.Stop()
+
+	for i := 0; i < streamChunks; i++ {
+		if a.draining() {
+			requestLog(c).Warn("stream interrupted by shutdown", "event", "stream_interrupted", "chunks_sent", i)
+			writeStreamLine(c, gin.H{"error": "stream interrupted: server shutting down", "interrupted": true, "chunks_sent": i})
+			return
+		}
+		writeStreamLine(c, gin.H{"chunk": i, "of": streamChunks})
+
+		select {
+		case <-c.Request.Context().Done():
+			// The client is gone; there is nobody left to tell
+			return
+		case <-ticker.C:
+		}
+	}
+	writeStreamLine(c, gin.H{"done": true, "chunks_sent": streamChunks})
+}
+
+// writeStreamLine writes v as one JSON line and flushes it to the client.
+func writeStreamLine(c *gin.Context, v gin.H) {
+	json.NewEncoder(c.Writer).Encode(v)
+	c.Writer.Flush()
+}
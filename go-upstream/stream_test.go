@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"syscall"
+	"testing"
+)
+
+func TestStreamWritesInterruptionMarkerOnShutdown(t *testing.T) {
+	a := newApp(shutdownTestConfig())
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: newRouter(a)}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+
+	resp, err := http.Get("http://" + addr + "/stream")
+	if err != nil {
+		t.Fatalf("GET /stream: %v", err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() {
+		t.Fatalf("no first chunk: %v", lines.Err())
+	}
+	if n := a.inFlight.Load(); n != 1 {
+		t.Errorf("in flight during stream = %d, want 1", n)
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+	var last map[string]any
+	for lines.Scan() {
+		last = nil
+		if err := json.Unmarshal(lines.Bytes(), &last); err != nil {
+			t.Fatalf("decode %s: %v", lines.Text(), err)
+		}
+	}
+	if last["interrupted"] != true {
+		t.Errorf("last line = %v, want the interruption marker", last)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("serveGraceful: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTracedApp(t *testing.T, cfg Config) (*app, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	a := newApp(cfg)
+	a.tracerProvider = tp
+	return a, exp
+}
+
+func TestTracingRecordsOneSpanPerRequest(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	a, exp := newTracedApp(t, cfg)
+	r := newRouter(a)
+
+	for i := 0; i < 3; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/data", nil))
+	}
+
+	spans := exp.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	for _, s := range spans {
+		if s.Name != "GET /api/data" {
+			t.Errorf("span name = %q, want %q", s.Name, "GET /api/data")
+		}
+		if s.SpanKind != trace.SpanKindServer {
+			t.Errorf("span kind = %v, want server", s.SpanKind)
+		}
+	}
+}
+
+func TestTracingContinuesIncomingTraceparent(t *testing.T) {
+	a, exp := newTracedApp(t, defaultConfig())
+	r := newRouter(a)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	if got := spans[0].SpanContext.TraceID().String(); got != traceID {
+		t.Errorf("trace ID = %s, want %s", got, traceID)
+	}
+	if got := spans[0].Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span ID = %s, want 00f067aa0ba902b7", got)
+	}
+}
+
+func TestDownstreamCallCarriesTraceContext(t *testing.T) {
+	var traceparent string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{}`))
+	}))
+	defer downstream.Close()
+
+	cfg := defaultConfig()
+	cfg.MinLatencyMs, cfg.MaxLatencyMs = 0, 0
+	cfg.UpstreamURL = downstream.URL
+	a, exp := newTracedApp(t, cfg)
+	r := newRouter(a)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/data", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	sc := spans[0].SpanContext
+	want := "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-01"
+	if traceparent != want {
+		t.Errorf("downstream traceparent = %q, want %q", traceparent, want)
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+// Build metadata, injected at build time with e.g.
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=abc123 -X main.buildTime=2026-01-01T00:00:00Z"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
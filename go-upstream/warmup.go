@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const defaultWarmupTimeout = 30 * time.Second
+
+// warmupCancelWait bounds how long a shutdown during startup waits for
+// cancelled warmups to return before exiting without them.
+const warmupCancelWait = 5 * time.Second
+
+// errShutdownDuringStartup is returned by serveGraceful when a shutdown
+// signal or request arrived before the server started serving traffic.
+var errShutdownDuringStartup = errors.New("shutdown during startup")
+
+// RegisterWarmup adds fn to the work that must finish before /ready
+// passes, e.g. priming a cache. Register before the server starts.
+func (a *app) RegisterWarmup(fn func(context.Context) error) {
+	a.warmups = append(a.warmups, fn)
+	a.warming.Store(true)
+}
+
+// runWarmups runs the registered warmups in order within WARMUP_TIMEOUT.
+// On success /ready starts passing; on error it stays failing and the
+// caller is expected to exit so the pod fails to start.
+func (a *app) runWarmups(ctx context.Context) error {
+	if len(a.warmups) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.cfg.WarmupTimeout)
+	defer cancel()
+
+	start := time.Now()
+	for i, fn := range a.warmups {
+		if err := fn(ctx); err != nil {
+			return fmt.Errorf("warmup %d: %w", i, err)
+		}
+	}
+	a.warming.Store(false)
+	slog.Info("warmup hooks complete", "event", "warmup_hooks_done", "hooks", len(a.warmups), "elapsed_ms", time.Since(start).Milliseconds())
+	return nil
+}
+
+// coldStartOrQuit waits STARTUP_DELAY before the server binds, so probes
+// get connection refused the way they would from a slow-starting process.
+// A signal on quit or a shutdown request ends the wait and reports
+// errShutdownDuringStartup.
+func (a *app) coldStartOrQuit(quit <-chan os.Signal) error {
+	delay := a.cfg.StartupDelay
+	if delay <= 0 {
+		return nil
+	}
+	slog.Info("simulating cold start before binding", "event", "cold_start", "delay_ms", delay.Milliseconds())
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case sig := <-quit:
+		logShutdownDuringStartup(sig.String())
+	case <-a.shutdownRequested:
+		logShutdownDuringStartup("admin")
+	}
+	return errShutdownDuringStartup
+}
+
+// warmupOrQuit runs the warmups once the server is listening, while /ready
+// reports warming_up so the pod takes no traffic yet. A signal on quit or
+// a shutdown request cancels the hooks, waits up to warmupCancelWait for
+// them to return, and reports errShutdownDuringStartup; a failed warmup
+// is fatal.
+func (a *app) warmupOrQuit(quit <-chan os.Signal) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- a.runWarmups(ctx) }()
+
+	var from string
+	select {
+	case err := <-done:
+		if err != nil {
+			fatal("warmup failed", "event", "warmup_failed", "error", err)
+		}
+		return nil
+	case sig := <-quit:
+		from = sig.String()
+	case <-a.shutdownRequested:
+		from = "admin"
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(warmupCancelWait):
+		slog.Warn("warmup hooks ignored cancellation", "event", "warmup_abandoned", "wait_ms", warmupCancelWait.Milliseconds())
+	}
+	logShutdownDuringStartup(from)
+	return errShutdownDuringStartup
+}
+
+func logShutdownDuringStartup(signal string) {
+	slog.Info("shutdown during startup — exiting without serving", "event", "shutdown_during_startup", "signal", signal)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReadyWaitsForWarmup(t *testing.T) {
+	a := newApp(defaultConfig())
+	r := newRouter(a)
+	release := make(chan struct{})
+	a.RegisterWarmup(func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- a.runWarmups(context.Background()) }()
+
+	if got := statusOf(r, "/ready"); got != http.StatusServiceUnavailable {
+		t.Errorf("/ready during warmup = %d, want 503", got)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("runWarmups: %v", err)
+	}
+	if got := statusOf(r, "/ready"); got != http.StatusOK {
+		t.Errorf("/ready after warmup = %d, want 200", got)
+	}
+}
+
+func TestFailedWarmupNeverBecomesReady(t *testing.T) {
+	a := newApp(defaultConfig())
+	r := newRouter(a)
+	boom := errors.New("cache unreachable")
+	a.RegisterWarmup(func(ctx context.Context) error { return boom })
+
+	if err := a.runWarmups(context.Background()); !errors.Is(err, boom) {
+		t.Fatalf("runWarmups = %v, want %v", err, boom)
+	}
+	if got := statusOf(r, "/ready"); got != http.StatusServiceUnavailable {
+		t.Errorf("/ready after failed warmup = %d, want 503", got)
+	}
+}
+
+func TestWarmupTimeout(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.WarmupTimeout = 20 * time.Millisecond
+	a := newApp(cfg)
+	a.RegisterWarmup(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err := a.runWarmups(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("runWarmups = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestSignalDuringWarmupExitsWithoutServing(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := shutdownTestConfig()
+	cfg.Addr = freeAddr(t)
+	a := newApp(cfg)
+	warming := make(chan struct{})
+	cancelled := make(chan struct{})
+	a.RegisterWarmup(func(ctx context.Context) error {
+		close(warming)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	srv := newHTTPServer(cfg, newRouter(a))
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+
+	<-warming
+	resp, err := http.Get("http://" + cfg.Addr + "/ready")
+	if err != nil {
+		t.Fatalf("GET /ready during warmup: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("/ready during warmup = %d, want 503", resp.StatusCode)
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+	select {
+	case err := <-done:
+		if !errors.Is(err, errShutdownDuringStartup) {
+			t.Fatalf("serveGraceful = %v, want errShutdownDuringStartup", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveGraceful did not return after SIGTERM during warmup")
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Error("warmup hook was not cancelled")
+	}
+	waitForLog(t, logs, "shutdown_during_startup")
+	if conn, err := net.DialTimeout("tcp", cfg.Addr, time.Second); err == nil {
+		conn.Close()
+		t.Error("server still listening after the signal during warmup")
+	}
+}
+
+func TestShutdownRequestDuringWarmupExits(t *testing.T) {
+	a := newApp(shutdownTestConfig())
+	warming := make(chan struct{})
+	a.RegisterWarmup(func(ctx context.Context) error {
+		close(warming)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	srv := &http.Server{Addr: freeAddr(t), Handler: newRouter(a)}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+
+	<-warming
+	a.requestShutdown()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errShutdownDuringStartup) {
+			t.Fatalf("serveGraceful = %v, want errShutdownDuringStartup", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveGraceful did not return after a shutdown request during warmup")
+	}
+}
+
+func TestShutdownRequestDuringStartupDelayExits(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := shutdownTestConfig()
+	cfg.StartupDelay = time.Minute
+	a := newApp(cfg)
+	srv := &http.Server{Addr: freeAddr(t), Handler: newRouter(a)}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+
+	waitForLog(t, logs, "cold_start")
+	a.requestShutdown()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errShutdownDuringStartup) {
+			t.Fatalf("serveGraceful = %v, want errShutdownDuringStartup", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveGraceful did not return after a shutdown request during STARTUP_DELAY")
+	}
+}
+
+func TestStartupDelayHoldsOffBinding(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := shutdownTestConfig()
+	cfg.StartupDelay = 300 * time.Millisecond
+	cfg.Addr = freeAddr(t)
+	a := newApp(cfg)
+	srv := newHTTPServer(cfg, newRouter(a))
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+
+	waitForLog(t, logs, "cold_start")
+	if conn, err := net.DialTimeout("tcp", cfg.Addr, 100*time.Millisecond); err == nil {
+		conn.Close()
+		t.Error("listener accepting during STARTUP_DELAY")
+	}
+	waitForServer(t, "http://"+cfg.Addr+"/startup")
+	if elapsed := time.Since(start); elapsed < cfg.StartupDelay {
+		t.Errorf("server came up after %s, before the %s STARTUP_DELAY", elapsed, cfg.StartupDelay)
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+	if err := <-done; err != nil {
+		t.Fatalf("serveGraceful: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// webhookTimeout bounds each shutdown notification so a slow receiver
+// costs the drain at most this much.
+const webhookTimeout = 2 * time.Second
+
+// shutdownWebhook POSTs shutdown_started and shutdown_complete to
+// SHUTDOWN_WEBHOOK_URL. Delivery is best effort: failures are logged and
+// never hold up or abort the shutdown.
+type shutdownWebhook struct {
+	url    string
+	host   string
+	client *http.Client
+	// started is closed once the shutdown_started delivery has finished,
+	// so shutdown_complete never overtakes it.
+	started chan struct{}
+}
+
+func newShutdownWebhook(url string) *shutdownWebhook {
+	host, _ := os.Hostname()
+	return &shutdownWebhook{url: url, host: host, client: &http.Client{Timeout: webhookTimeout}, started: make(chan struct{})}
+}
+
+// notifyStarted sends shutdown_started in the background so the drain
+// begins without waiting on the receiver.
+func (w *shutdownWebhook) notifyStarted() {
+	go func() {
+		defer close(w.started)
+		w.send(context.Background(), "shutdown_started")
+	}()
+}
+
+// notifyComplete sends shutdown_complete after shutdown_started has been
+// delivered or given up on. It blocks, bounded by webhookTimeout per
+// event, so the notification goes out before the process exits.
+func (w *shutdownWebhook) notifyComplete() {
+	<-w.started
+	w.send(context.Background(), "shutdown_complete")
+}
+
+func (w *shutdownWebhook) send(ctx context.Context, event string) {
+	body, _ := json.Marshal(map[string]string{
+		"event":     event,
+		"host":      w.host,
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err := w.post(ctx, body); err != nil {
+		slog.Warn("shutdown webhook failed", "event", "shutdown_webhook_failed", "webhook_event", event, "error", err)
+		return
+	}
+	slog.Debug("shutdown webhook delivered", "event", "shutdown_webhook_sent", "webhook_event", event)
+}
+
+func (w *shutdownWebhook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver answered %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownWebhookReceivesBothEventsInOrder(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []map[string]string
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode webhook body: %v", err)
+		}
+		mu.Lock()
+		events = append(events, body)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	cfg := shutdownTestConfig()
+	cfg.ShutdownWebhookURL = receiver.URL
+	a := newApp(cfg)
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: newRouter(a)}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+
+	sendSignal(t, syscall.SIGTERM)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveGraceful: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || events[0]["event"] != "shutdown_started" || events[1]["event"] != "shutdown_complete" {
+		t.Fatalf("webhook events = %v, want shutdown_started then shutdown_complete", events)
+	}
+	host, _ := os.Hostname()
+	for _, e := range events {
+		if e["host"] != host {
+			t.Errorf("host = %q, want %q", e["host"], host)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, e["timestamp"]); err != nil {
+			t.Errorf("timestamp %q: %v", e["timestamp"], err)
+		}
+	}
+}
+
+func TestShutdownWebhookFailureDoesNotAbortShutdown(t *testing.T) {
+	logs := captureLogs(t)
+	cfg := shutdownTestConfig()
+	// Nothing listens here, so every delivery fails
+	cfg.ShutdownWebhookURL = "http://" + freeAddr(t)
+	a := newApp(cfg)
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: newRouter(a)}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+
+	sendSignal(t, syscall.SIGTERM)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveGraceful: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+	waitForLog(t, logs, "shutdown_webhook_failed")
+}
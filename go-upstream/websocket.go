@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsCloseWait bounds writing the close frame to a single client.
+	wsCloseWait = time.Second
+	// wsCloseMaxBudget caps how long shutdown waits for clients to
+	// answer the close frame; see wsCloseBudget.
+	wsCloseMaxBudget = 5 * time.Second
+)
+
+// wsCloseBudget is the share of the shutdown timeout spent waiting for
+// WebSocket clients to disconnect, so a client that never reads can't
+// leave the HTTP drain without time.
+func wsCloseBudget(shutdownTimeout time.Duration) time.Duration {
+	return min(shutdownTimeout/4, wsCloseMaxBudget)
+}
+
+var wsUpgrader = websocket.Upgrader{}
+
+// wsRegistry tracks open WebSocket connections. Hijacked connections are
+// invisible to srv.Shutdown, so the shutdown path closes them through here.
+type wsRegistry struct {
+	mu    sync.Mutex
+	conns map[*websocket.Conn]struct{}
+	// empty is closed and replaced by closeAll's waiter when the last
+	// connection goes away.
+	empty chan struct{}
+}
+
+func (r *wsRegistry) add(conn *websocket.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conns == nil {
+		r.conns = make(map[*websocket.Conn]struct{})
+	}
+	r.conns[conn] = struct{}{}
+}
+
+func (r *wsRegistry) remove(conn *websocket.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, conn)
+	if len(r.conns) == 0 && r.empty != nil {
+		close(r.empty)
+		r.empty = nil
+	}
+}
+
+// Len reports how many connections are open.
+func (r *wsRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns)
+}
+
+// closeAll sends a going-away close frame to every client and waits for
+// them to disconnect. Connections still open when ctx is done are closed
+// without waiting further.
+func (r *wsRegistry) closeAll(ctx context.Context) error {
+	r.mu.Lock()
+	conns := make([]*websocket.Conn, 0, len(r.conns))
+	for conn := range r.conns {
+		conns = append(conns, conn)
+	}
+	var empty chan struct{}
+	if len(conns) > 0 {
+		r.empty = make(chan struct{})
+		empty = r.empty
+	}
+	r.mu.Unlock()
+	if len(conns) == 0 {
+		return nil
+	}
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for _, conn := range conns {
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsCloseWait))
+	}
+	slog.Info("closing websockets", "event", "websocket_close_sent", "connections", len(conns))
+
+	select {
+	case <-empty:
+		return nil
+	case <-ctx.Done():
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	slog.Warn("forcing websockets closed", "event", "websocket_close_forced", "connections", len(r.conns))
+	for conn := range r.conns {
+		conn.Close()
+	}
+	return ctx.Err()
+}
+
+// handleWS upgrades to a WebSocket and echoes every message back until the
+// client disconnects or the shutdown path closes the connection.
+func (a *app) handleWS(c *gin.Context) {
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written the error response
+		return
+	}
+	// The server's read and write timeouts would otherwise cut the
+	// connection off mid-session
+	conn.NetConn().SetDeadline(time.Time{})
+
+	a.websockets.add(conn)
+	defer func() {
+		a.websockets.remove(conn)
+		conn.Close()
+	}()
+	for {
+		kind, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := conn.WriteMessage(kind, msg); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestShutdownSendsWebSocketCloseFrame(t *testing.T) {
+	a := newApp(shutdownTestConfig())
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: newRouter(a)}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "ping" {
+		t.Fatalf("echo = %q, %v; want ping", msg, err)
+	}
+	if n := a.websockets.Len(); n != 1 {
+		t.Fatalf("registry has %d connections, want 1", n)
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("read after shutdown = %v, want a going-away close frame", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveGraceful: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not finish after the client disconnected")
+	}
+	if n := a.websockets.Len(); n != 0 {
+		t.Errorf("registry has %d connections after shutdown, want 0", n)
+	}
+}
+
+func TestShutdownClosesUnresponsiveWebSocketWithinItsShare(t *testing.T) {
+	cfg := shutdownTestConfig()
+	cfg.ShutdownTimeout = 2 * time.Second
+	a := newApp(cfg)
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: newRouter(a)}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+
+	// The client never reads, so it never answers the close frame
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	for a.websockets.Len() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start := time.Now()
+	sendSignal(t, syscall.SIGTERM)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serveGraceful = %v, want a clean shutdown", err)
+		}
+	case <-time.After(cfg.ShutdownTimeout + time.Second):
+		t.Fatal("shutdown did not finish")
+	}
+	if elapsed := time.Since(start); elapsed >= cfg.ShutdownTimeout {
+		t.Errorf("shutdown took %s, want the websocket wait bounded below SHUTDOWN_TIMEOUT", elapsed)
+	}
+	assertShutdownOutcome(t, a, "clean")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// workQueueSize bounds the jobs waiting for a worker.
+	workQueueSize = 100
+	// defaultJobDuration is how long a job simulates work for when
+	// /enqueue gives no duration_ms.
+	defaultJobDuration = 100 * time.Millisecond
+)
+
+var (
+	errPoolClosed    = errors.New("worker pool stopped")
+	errWorkQueueFull = errors.New("work queue full")
+)
+
+// job is one unit of simulated background work.
+type job struct {
+	id       int64
+	duration time.Duration
+}
+
+// workerPool drains a buffered job queue with a fixed number of workers.
+// On shutdown it stops taking jobs and lets the workers finish the queue.
+type workerPool struct {
+	// mu orders submit against stop, so no job is sent on a closed
+	// channel.
+	mu     sync.Mutex
+	closed bool
+	jobs   chan job
+	wg     sync.WaitGroup
+
+	seq       atomic.Int64
+	running   atomic.Int64
+	processed atomic.Int64
+}
+
+func newWorkerPool(workers int) *workerPool {
+	p := &workerPool{jobs: make(chan job, workQueueSize)}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+func (p *workerPool) work() {
+	defer p.wg.Done()
+	for j := range p.jobs {
+		p.running.Add(1)
+		time.Sleep(j.duration)
+		p.running.Add(-1)
+		p.processed.Add(1)
+		slog.Debug("job processed", "event", "job_processed", "job_id", j.id, "duration_ms", j.duration.Milliseconds())
+	}
+}
+
+// submit queues a job, failing once the pool is stopped or the queue is
+// full. It never blocks.
+func (p *workerPool) submit(d time.Duration) (job, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return job{}, errPoolClosed
+	}
+	j := job{id: p.seq.Add(1), duration: d}
+	select {
+	case p.jobs <- j:
+		return j, nil
+	default:
+		return job{}, errWorkQueueFull
+	}
+}
+
+// pending counts the jobs queued or being worked on.
+func (p *workerPool) pending() int64 {
+	return int64(len(p.jobs)) + p.running.Load()
+}
+
+// stop closes the queue and waits for the workers to empty it. If ctx
+// ends first the jobs left over are logged and reported in the error.
+func (p *workerPool) stop(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+	slog.Info("worker pool draining", "event", "worker_pool_draining", "pending", p.pending())
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		slog.Info("worker pool drained", "event", "worker_pool_drained", "processed", p.processed.Load())
+		return nil
+	case <-ctx.Done():
+		left := p.pending()
+		slog.Error("worker pool did not drain before the shutdown timeout", "event", "worker_pool_timeout", "unprocessed", left)
+		return fmt.Errorf("%d jobs unprocessed: %w", left, ctx.Err())
+	}
+}
+
+// handleEnqueue queues a job that sleeps for duration_ms (default 100).
+func (a *app) handleEnqueue(c *gin.Context) {
+	d := defaultJobDuration
+	if raw := c.Query("duration_ms"); raw != "" {
+		ms, err := strconv.Atoi(raw)
+		if err != nil || ms < 0 {
+			abortWithError(c, http.StatusBadRequest, codeInvalidRequest, "duration_ms must be a non-negative integer")
+			return
+		}
+		d = time.Duration(ms) * time.Millisecond
+	}
+	j, err := a.workers.submit(d)
+	switch {
+	case errors.Is(err, errPoolClosed):
+		abortWithError(c, http.StatusServiceUnavailable, codeShuttingDown, "worker pool is shutting down")
+		return
+	case errors.Is(err, errWorkQueueFull):
+		c.Header("Retry-After", "1")
+		abortWithError(c, http.StatusServiceUnavailable, codeOverCapacity, "work queue is full")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"job_id": j.id, "pending": a.workers.pending()})
+}
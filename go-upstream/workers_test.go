@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownProcessesQueuedJobs(t *testing.T) {
+	cfg := shutdownTestConfig()
+	cfg.NumWorkers = 2
+	a := newApp(cfg)
+	r := newRouter(a)
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: r}
+	done := make(chan error, 1)
+	go func() { done <- a.serveGraceful(srv) }()
+	waitForServer(t, "http://"+addr+"/health")
+
+	const jobs = 6
+	for i := 0; i < jobs; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/enqueue?duration_ms=50", nil))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("enqueue %d: status = %d, want 202", i, w.Code)
+		}
+	}
+
+	start := time.Now()
+	sendSignal(t, syscall.SIGTERM)
+	if err := <-done; err != nil {
+		t.Fatalf("serveGraceful: %v", err)
+	}
+	if n := a.workers.processed.Load(); n != jobs {
+		t.Errorf("processed %d jobs before exit, want %d", n, jobs)
+	}
+	if elapsed := time.Since(start); elapsed > cfg.ShutdownTimeout {
+		t.Errorf("shutdown took %s, over the %s budget", elapsed, cfg.ShutdownTimeout)
+	}
+	if _, err := a.workers.submit(0); !errors.Is(err, errPoolClosed) {
+		t.Errorf("submit after shutdown = %v, want errPoolClosed", err)
+	}
+}
+
+func TestWorkerPoolReportsUnprocessedJobsOnTimeout(t *testing.T) {
+	logs := captureLogs(t)
+	p := newWorkerPool(1)
+	for i := 0; i < 3; i++ {
+		if _, err := p.submit(time.Second); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := p.stop(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "3 jobs unprocessed") {
+		t.Errorf("stop = %v, want 3 jobs unprocessed and DeadlineExceeded", err)
+	}
+	waitForLog(t, logs, "worker_pool_timeout")
+}
+
+func TestEnqueueNotMountedWithoutWorkers(t *testing.T) {
+	w := httptest.NewRecorder()
+	newRouter(newApp(defaultConfig())).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/enqueue", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("/enqueue with NUM_WORKERS=0 = %d, want 404", w.Code)
+	}
+}